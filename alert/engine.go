@@ -0,0 +1,338 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// queueSize is the number of notifications waiting to be sent before further
+// notifications are dropped.
+const queueSize = 64
+
+// notifyTimeout limits how long a webhook or command may take.
+const notifyTimeout = 30 * time.Second
+
+// Status is the state of a rule that a notification reports.
+type Status string
+
+const (
+	Firing   Status = "firing"
+	Resolved Status = "resolved"
+)
+
+// Notification is sent when a rule fires or resolves.
+type Notification struct {
+	Rule   string `json:"rule"`
+	Stream string `json:"stream"`
+	Status Status `json:"status"`
+
+	// Value is the aggregate of the band in the sweep that changed the
+	// status.
+	Value         unit.Decabel   `json:"value"`
+	Threshold     unit.Decabel   `json:"threshold"`
+	Aggregate     Aggregate      `json:"aggregate"`
+	PeakFrequency unit.Frequency `json:"peak_frequency"`
+
+	StartFrequency unit.Frequency `json:"start_frequency"`
+	EndFrequency   unit.Frequency `json:"end_frequency"`
+
+	// Since is when the power first reached the threshold, and Time the sweep
+	// that changed the status. Both are the times recorded by rtl_power.
+	Since time.Time `json:"since"`
+	Time  time.Time `json:"time"`
+}
+
+// state follows a rule on a stream.
+type state struct {
+	// pending is when the power reached the threshold, zero while it is
+	// below.
+	pending time.Time
+	firing  bool
+	// notified is whether the current firing was notified.
+	notified bool
+	// last is when the rule was last notified as firing.
+	last time.Time
+
+	notification Notification
+}
+
+type stateKey struct {
+	stream, rule string
+}
+
+// Engine evaluates the rules against each sweep of each stream. The times of
+// the sweeps are used throughout, so that a replayed recording alerts as it
+// would have live.
+type Engine struct {
+	mu     sync.Mutex
+	rules  []Rule
+	states map[stateKey]*state
+
+	queue  chan delivery
+	client *http.Client
+}
+
+type delivery struct {
+	target       Target
+	notification Notification
+}
+
+// New returns an engine for the rules, sending its notifications in the
+// background.
+func New(rules []Rule) *Engine {
+	e := &Engine{
+		rules:  rules,
+		states: map[stateKey]*state{},
+		queue:  make(chan delivery, queueSize),
+		client: &http.Client{Timeout: notifyTimeout},
+	}
+
+	go e.deliver()
+
+	return e
+}
+
+// SetRules replaces the rules. Rules that are kept, by name, keep their
+// state.
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = rules
+
+	for key := range e.states {
+		if !slices.ContainsFunc(rules, func(rule Rule) bool { return rule.Name == key.rule }) {
+			delete(e.states, key)
+		}
+	}
+}
+
+// Rules returns the rules.
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.rules
+}
+
+// Firing returns the notifications of the rules that are firing.
+func (e *Engine) Firing() []Notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	firing := []Notification{}
+	for _, s := range e.states {
+		if s.firing {
+			firing = append(firing, s.notification)
+		}
+	}
+
+	slices.SortFunc(firing, func(a, b Notification) int {
+		return a.Since.Compare(b.Since)
+	})
+
+	return firing
+}
+
+// Evaluate checks the rules of the stream against a completed sweep.
+func (e *Engine) Evaluate(stream string, sweep *power.Scan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		if !rule.appliesTo(stream) {
+			continue
+		}
+
+		m, ok := rule.band().Measure(sweep)
+		if !ok {
+			continue
+		}
+
+		value := m.PeakPower
+		if rule.Aggregate == Mean {
+			value = m.Mean
+		}
+
+		key := stateKey{stream, rule.Name}
+		s, ok := e.states[key]
+		if !ok {
+			s = &state{}
+			e.states[key] = s
+		}
+
+		now := sweep.DateTime
+
+		n := Notification{
+			Rule:           rule.Name,
+			Stream:         stream,
+			Value:          value,
+			Threshold:      rule.Threshold,
+			Aggregate:      rule.Aggregate,
+			PeakFrequency:  m.PeakFrequency,
+			StartFrequency: rule.Start,
+			EndFrequency:   rule.End,
+			Time:           now,
+		}
+
+		switch {
+		case s.firing:
+			if value >= rule.Threshold-rule.Hysteresis {
+				continue
+			}
+
+			s.firing = false
+			s.pending = time.Time{}
+
+			if s.notified {
+				n.Status = Resolved
+				n.Since = s.notification.Since
+				e.send(rule, n)
+			}
+
+		case value >= rule.Threshold:
+			if s.pending.IsZero() {
+				s.pending = now
+			}
+
+			if now.Sub(s.pending) < time.Duration(rule.Hold) {
+				continue
+			}
+
+			n.Status = Firing
+			n.Since = s.pending
+
+			s.firing = true
+			s.notification = n
+			s.notified = s.last.IsZero() || now.Sub(s.last) >= time.Duration(rule.RateLimit)
+
+			if s.notified {
+				s.last = now
+				e.send(rule, n)
+			} else {
+				log.Debugf("alert %s on %s is rate limited", rule.Name, stream)
+			}
+
+		default:
+			s.pending = time.Time{}
+		}
+	}
+}
+
+// send queues the notification for each target of the rule.
+func (e *Engine) send(rule Rule, n Notification) {
+	for _, target := range rule.Notify {
+		select {
+		case e.queue <- delivery{target, n}:
+		default:
+			log.Errorf("alert %s on %s: too many notifications queued, dropping one", n.Rule, n.Stream)
+		}
+	}
+}
+
+// deliver sends the queued notifications in order.
+func (e *Engine) deliver() {
+	for d := range e.queue {
+		if err := e.notify(d.target, d.notification); err != nil {
+			log.Errorf("alert %s on %s: %v", d.notification.Rule, d.notification.Stream, err)
+		}
+	}
+}
+
+func (e *Engine) notify(target Target, n Notification) error {
+	switch {
+	case target.Log:
+		entry := log.WithFields(log.Fields{
+			"rule":      n.Rule,
+			"stream":    n.Stream,
+			"value":     float64(n.Value),
+			"threshold": float64(n.Threshold),
+			"peak":      n.PeakFrequency.String(),
+		})
+
+		if n.Status == Firing {
+			entry.Warnf("alert %s is firing", n.Rule)
+		} else {
+			entry.Infof("alert %s resolved", n.Rule)
+		}
+
+		return nil
+
+	case target.Webhook != "":
+		return e.webhook(target, n)
+
+	default:
+		return run(target.Exec, n)
+	}
+}
+
+// webhook POSTs the notification as JSON.
+func (e *Engine) webhook(target Target, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range target.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: %s", target.Webhook, resp.Status)
+	}
+
+	return nil
+}
+
+// run runs the command with the notification as JSON on stdin, and its main
+// fields in the environment.
+func run(command string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"NUMA_ALERT_RULE="+n.Rule,
+		"NUMA_ALERT_STREAM="+n.Stream,
+		"NUMA_ALERT_STATUS="+string(n.Status),
+		fmt.Sprintf("NUMA_ALERT_VALUE=%.2f", float64(n.Value)),
+		fmt.Sprintf("NUMA_ALERT_PEAK_FREQUENCY=%.0f", float64(n.PeakFrequency)),
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", command, err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package alert watches sweeps for power in a band crossing a threshold and
+// notifies webhooks, commands or the log when it does, and again when it
+// stops.
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Duration is a time.Duration given as a string such as "30s" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("expected a duration such as \"30s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Aggregate reduces the bins of a band to the value compared against the
+// threshold.
+type Aggregate string
+
+const (
+	// Peak takes the strongest bin.
+	Peak Aggregate = "peak"
+	// Mean takes the mean power of the bins.
+	Mean Aggregate = "mean"
+)
+
+// Target is where notifications of a rule are sent. Exactly one of its fields
+// is set.
+type Target struct {
+	// Webhook is a URL the notification is POSTed to as JSON, with the
+	// Headers.
+	Webhook string            `json:"webhook,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Exec is a shell command run with the notification as JSON on stdin.
+	Exec string `json:"exec,omitempty"`
+
+	// Log writes the notification to the log.
+	Log bool `json:"log,omitempty"`
+}
+
+// Rule fires when the power in a band reaches the threshold.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Streams limits the rule to the named streams, empty for every stream.
+	Streams []string `json:"streams,omitempty"`
+
+	Start     unit.Frequency `json:"start"`
+	End       unit.Frequency `json:"end"`
+	Threshold unit.Decabel   `json:"threshold"`
+	Aggregate Aggregate      `json:"aggregate"`
+
+	// Hold is how long the power must stay at the threshold before the rule
+	// fires.
+	Hold Duration `json:"hold,omitempty"`
+	// Hysteresis is how far below the threshold the power must fall before
+	// a firing rule resolves.
+	Hysteresis unit.Decabel `json:"hysteresis,omitempty"`
+	// RateLimit is the least time between two notifications that the rule
+	// fired. A firing that is not notified is not notified as resolved either.
+	RateLimit Duration `json:"rate_limit,omitempty"`
+
+	Notify []Target `json:"notify"`
+}
+
+func (rule *Rule) band() band.Band {
+	return band.Band{Name: rule.Name, Start: rule.Start, End: rule.End}
+}
+
+// appliesTo reports whether the rule watches the stream.
+func (rule *Rule) appliesTo(stream string) bool {
+	return len(rule.Streams) == 0 || slices.Contains(rule.Streams, stream)
+}
+
+// Validate checks the rule and fills in the default aggregate, peak.
+func (rule *Rule) Validate() error {
+	if rule.Aggregate == "" {
+		rule.Aggregate = Peak
+	}
+
+	switch {
+	case rule.Name == "":
+		return fmt.Errorf("a rule needs a name")
+	case rule.End <= rule.Start:
+		return fmt.Errorf("rule %s: the band ends before it starts", rule.Name)
+	case rule.Aggregate != Peak && rule.Aggregate != Mean:
+		return fmt.Errorf("rule %s: unknown aggregate %q, expected peak or mean", rule.Name, rule.Aggregate)
+	case rule.Hold < 0 || rule.RateLimit < 0:
+		return fmt.Errorf("rule %s: durations cannot be negative", rule.Name)
+	case rule.Hysteresis < 0:
+		return fmt.Errorf("rule %s: hysteresis cannot be negative", rule.Name)
+	case len(rule.Notify) == 0:
+		return fmt.Errorf("rule %s: nothing to notify", rule.Name)
+	}
+
+	for _, target := range rule.Notify {
+		set := 0
+		for _, ok := range []bool{target.Webhook != "", target.Exec != "", target.Log} {
+			if ok {
+				set++
+			}
+		}
+
+		if set != 1 {
+			return fmt.Errorf("rule %s: a target needs exactly one of webhook, exec or log", rule.Name)
+		}
+
+		if target.Webhook != "" {
+			u, err := url.Parse(target.Webhook)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("rule %s: invalid webhook %q", rule.Name, target.Webhook)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Load reads a rules file, a JSON object with a list of `rules`.
+func Load(name string) ([]Rule, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	names := map[string]bool{}
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%s: rule %s is given twice", name, rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	return file.Rules, nil
+}
@@ -0,0 +1,216 @@
+// Package annotation keeps notes on regions of the waterfall: a time range
+// and a frequency range with a label, so that observers can point each other
+// at what they found.
+package annotation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/internal/atomicfile"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// DefaultColour is given to annotations created without a colour.
+const DefaultColour = "#ffeb3b"
+
+var (
+	// ErrInvalid is wrapped by the errors of Validate.
+	ErrInvalid = errors.New("invalid annotation")
+	// ErrNotFound is returned when deleting an annotation that does not
+	// exist.
+	ErrNotFound = errors.New("annotation not found")
+)
+
+var colour = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// Annotation marks a region of time and frequency.
+type Annotation struct {
+	ID string `json:"id"`
+
+	Start          time.Time      `json:"start"`
+	End            time.Time      `json:"end"`
+	StartFrequency unit.Frequency `json:"start_frequency"`
+	EndFrequency   unit.Frequency `json:"end_frequency"`
+
+	Label  string `json:"label"`
+	Author string `json:"author"`
+	// Colour is an HTML colour, #rrggbb.
+	Colour string `json:"colour"`
+
+	Created time.Time `json:"created"`
+}
+
+// Validate checks that the ranges are not reversed and that the annotation
+// has a label and a valid colour.
+func (a *Annotation) Validate() error {
+	switch {
+	case a.Start.IsZero() || a.End.IsZero():
+		return fmt.Errorf("%w: it needs a start and an end", ErrInvalid)
+	case a.End.Before(a.Start):
+		return fmt.Errorf("%w: it ends before it starts", ErrInvalid)
+	case a.EndFrequency < a.StartFrequency:
+		return fmt.Errorf("%w: its end frequency is below its start frequency", ErrInvalid)
+	case a.Label == "":
+		return fmt.Errorf("%w: it needs a label", ErrInvalid)
+	case a.Colour != "" && !colour.MatchString(a.Colour):
+		return fmt.Errorf("%w: colour %q is not #rrggbb", ErrInvalid, a.Colour)
+	}
+
+	return nil
+}
+
+// Overlaps reports whether the annotation covers any of [start, end]. A zero
+// time leaves that side open.
+func (a *Annotation) Overlaps(start, end time.Time) bool {
+	return (start.IsZero() || !a.End.Before(start)) && (end.IsZero() || !a.Start.After(end))
+}
+
+// Load reads annotations saved by a Store.
+func Load(name string) ([]Annotation, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var annotations []Annotation
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return annotations, nil
+}
+
+// Store holds the annotations of a stream, saving them to a file on every
+// change. Without a file they are only held in memory.
+type Store struct {
+	File string
+
+	mu          sync.RWMutex
+	annotations []Annotation
+}
+
+// Open returns a store with the annotations of the file, if it exists.
+func Open(file string) (*Store, error) {
+	s := &Store{File: file}
+
+	if file == "" {
+		return s, nil
+	}
+
+	annotations, err := Load(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	s.annotations = annotations
+	return s, nil
+}
+
+// List returns the annotations ordered by start time.
+func (s *Store) List() []Annotation {
+	return s.Within(time.Time{}, time.Time{})
+}
+
+// Within returns the annotations overlapping [start, end] ordered by start
+// time.
+func (s *Store) Within(start, end time.Time) []Annotation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	annotations := []Annotation{}
+	for _, a := range s.annotations {
+		if a.Overlaps(start, end) {
+			annotations = append(annotations, a)
+		}
+	}
+
+	slices.SortStableFunc(annotations, func(a, b Annotation) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	return annotations
+}
+
+// Add validates and stores an annotation, giving it an ID, creation time and
+// the default colour when it has none.
+func (s *Store) Add(a Annotation) (Annotation, error) {
+	if err := a.Validate(); err != nil {
+		return a, err
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	a.ID = hex.EncodeToString(id)
+	a.Created = time.Now().UTC()
+	if a.Colour == "" {
+		a.Colour = DefaultColour
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	annotations := append(slices.Clip(s.annotations), a)
+	if err := s.save(annotations); err != nil {
+		return a, err
+	}
+
+	s.annotations = annotations
+	return a, nil
+}
+
+// Get returns the annotation with the ID.
+func (s *Store) Get(id string) (Annotation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.annotations, func(a Annotation) bool { return a.ID == id })
+	if i < 0 {
+		return Annotation{}, false
+	}
+
+	return s.annotations[i], true
+}
+
+// Delete removes the annotation with the ID.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.annotations, func(a Annotation) bool { return a.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	annotations := slices.Delete(slices.Clone(s.annotations), i, i+1)
+	if err := s.save(annotations); err != nil {
+		return err
+	}
+
+	s.annotations = annotations
+	return nil
+}
+
+// save writes the annotations to a temporary file that replaces the file, so
+// that a crash cannot leave it half written.
+func (s *Store) save(annotations []Annotation) error {
+	if s.File == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(annotations, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.File, data)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/annotation"
+	"github.com/olistrik/numa-sdr/api/export"
+	"github.com/olistrik/numa-sdr/api/sdr/power/floor"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// StationFlags describe the station for the headers of FITS files.
+type StationFlags struct {
+	Observer   string   `arg:"--observer" placeholder:"name"`
+	Telescope  string   `arg:"--telescope" placeholder:"name"`
+	Instrument string   `arg:"--instrument" default:"rtl_power" placeholder:"name"`
+	Object     string   `arg:"--object" placeholder:"name"`
+	Latitude   *float64 `arg:"--latitude" placeholder:"deg"`
+	Longitude  *float64 `arg:"--longitude" placeholder:"deg"`
+	Elevation  *float64 `arg:"--elevation" placeholder:"m"`
+}
+
+func (flags StationFlags) station() export.Station {
+	return export.Station{
+		Observer:   flags.Observer,
+		Telescope:  flags.Telescope,
+		Instrument: flags.Instrument,
+		Object:     flags.Object,
+		Latitude:   flags.Latitude,
+		Longitude:  flags.Longitude,
+		Elevation:  flags.Elevation,
+	}
+}
+
+// FloorFlags select how the noise floor of each bin is estimated.
+type FloorFlags struct {
+	FloorWindow     time.Duration `arg:"--floor-window" default:"10m" placeholder:"duration" help:"The window of sweeps the noise floor is estimated over."`
+	FloorPercentile float64       `arg:"--floor-percentile" default:"0.5" placeholder:"float" help:"The percentile of each bin taken as its floor, 0.5 being the median."`
+}
+
+// floorOptions returns the floor options selected by the flags.
+func (flags *FloorFlags) floorOptions() []floor.Option {
+	return []floor.Option{
+		floor.Window(flags.FloorWindow),
+		floor.Percentile(flags.FloorPercentile),
+	}
+}
+
+type ExportCmd struct {
+	Input
+	StationFlags
+
+	Output string         `arg:"-O,--output,required" placeholder:"file" help:"The file to write, its extension selects the format: .npz, .npy or .fits."`
+	Start  unit.Frequency `arg:"--start" default:"0" placeholder:"float" help:"Lowest frequency exported."`
+	End    unit.Frequency `arg:"--end" default:"0" placeholder:"float" help:"Highest frequency exported."`
+
+	Annotations string `arg:"--annotations" placeholder:"file" help:"An annotations.json saved by numa_web, whose annotations are written with the sweeps."`
+
+	Reference string `arg:"--reference" placeholder:"file.json" help:"Export the difference from a reference saved by numa reference or numa_web."`
+
+	SNR bool `arg:"--snr" help:"Export each bin relative to its noise floor over the window up to it, rather than in dB."`
+	FloorFlags
+}
+
+// create writes a file with the writer, removing it again on failure.
+func create(name string, write func(*os.File) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(name)
+	}
+
+	return err
+}
+
+func (cmd *ExportCmd) Run() error {
+	ext := strings.ToLower(filepath.Ext(cmd.Output))
+
+	switch ext {
+	case ".npz", ".npy", ".fits", ".fit", ".fts":
+	default:
+		return fmt.Errorf("unknown export format %q, expected .npz, .npy or .fits", ext)
+	}
+
+	if cmd.SNR && cmd.Reference != "" {
+		return errors.New("--snr and --reference cannot be used together")
+	}
+
+	scans, err := cmd.Load()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Reference != "" {
+		if err := subtractReference(cmd.Reference, scans); err != nil {
+			return err
+		}
+	}
+
+	if cmd.SNR {
+		estimator := floor.New(cmd.floorOptions()...)
+
+		for i, scan := range scans {
+			estimator.Push(scan)
+			scans[i] = estimator.SNR(scan)
+		}
+	}
+
+	matrix, err := export.NewMatrix(scans, cmd.Start, cmd.End)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Annotations != "" {
+		annotations, err := annotation.Load(cmd.Annotations)
+		if err != nil {
+			return err
+		}
+
+		matrix.Annotate(annotations)
+	}
+
+	switch ext {
+	case ".npz":
+		return create(cmd.Output, func(file *os.File) error {
+			return matrix.WriteNpz(file)
+		})
+
+	case ".npy":
+		// a .npy holds a single array, the times, frequencies and
+		// annotations are written beside it.
+		base := strings.TrimSuffix(cmd.Output, filepath.Ext(cmd.Output))
+
+		if err := create(cmd.Output, func(file *os.File) error {
+			return matrix.WriteNpy(file)
+		}); err != nil {
+			return err
+		}
+
+		if err := create(base+".times.npy", func(file *os.File) error {
+			return export.WriteNpy(file, matrix.Times())
+		}); err != nil {
+			return err
+		}
+
+		if err := create(base+".frequencies.npy", func(file *os.File) error {
+			return export.WriteNpy(file, matrix.Frequencies())
+		}); err != nil {
+			return err
+		}
+
+		if matrix.Annotations == nil {
+			return nil
+		}
+
+		return create(base+".annotations.npy", func(file *os.File) error {
+			return matrix.WriteAnnotationsNpy(file)
+		})
+
+	default:
+		return create(cmd.Output, func(file *os.File) error {
+			return matrix.WriteFITS(file, cmd.station())
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	power_history "github.com/olistrik/numa-sdr/api/sdr/power/history"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// Input names the recorded rtl_power files a command reads.
+type Input struct {
+	Files  []string       `arg:"positional" placeholder:"file" help:"rtl_power CSV files, optionally gzipped, or directories of them. Reads stdin when none or - is given."`
+	Offset unit.Frequency `arg:"-o" default:"0" placeholder:"float" help:"The frequency offset when using an up/down converter."`
+	From   string         `arg:"--from" placeholder:"time" help:"Skip sweeps before this time."`
+	To     string         `arg:"--to" placeholder:"time" help:"Skip sweeps after this time."`
+}
+
+var args struct {
+	Render    *RenderCmd    `arg:"subcommand:render" help:"Render recorded sweeps as a PNG waterfall."`
+	Timelapse *TimelapseCmd `arg:"subcommand:timelapse" help:"Animate recorded sweeps as a GIF time-lapse."`
+	Export    *ExportCmd    `arg:"subcommand:export" help:"Export recorded sweeps for analysis elsewhere."`
+	Occupancy *OccupancyCmd `arg:"subcommand:occupancy" help:"Measure the duty cycle of each bin of recorded sweeps."`
+	Power     *PowerCmd     `arg:"subcommand:power" help:"Write the integrated power of a band in each recorded sweep as CSV."`
+	Profile   *ProfileCmd   `arg:"subcommand:profile" help:"Fold recorded sweeps onto a day or a week of mean power and occupancy."`
+	Reference *ReferenceCmd `arg:"subcommand:reference" help:"Average recorded sweeps into a reference spectrum."`
+	Stats     *StatsCmd     `arg:"subcommand:stats" help:"Summarise each bin of recorded sweeps as CSV."`
+	Webhook   *WebhookCmd   `arg:"subcommand:webhook" help:"Print the alert webhooks it receives, to try out alert rules."`
+}
+
+// open returns the named file, or stdin for -, transparently decompressing
+// gzip.
+func open(name string) (io.ReadCloser, error) {
+	file := os.Stdin
+	if name != "-" {
+		var err error
+		if file, err = os.Open(name); err != nil {
+			return nil, err
+		}
+	}
+
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, file}, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{buffered, file}, nil
+}
+
+// window parses the --from and --to flags, leaving missing ends zero.
+func (input Input) window() (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if input.From != "" {
+		if from, err = power.ParseTime(input.From); err != nil {
+			return from, to, err
+		}
+	}
+
+	if input.To != "" {
+		if to, err = power.ParseTime(input.To); err != nil {
+			return from, to, err
+		}
+	}
+
+	return from, to, nil
+}
+
+// files returns the input files, with each directory replaced by the .csv
+// and .csv.gz files in it, in order of name.
+func (input Input) files() ([]string, error) {
+	if len(input.Files) == 0 {
+		return []string{"-"}, nil
+	}
+
+	files := []string{}
+	for _, name := range input.Files {
+		info, err := os.Stat(name)
+		if name == "-" || err != nil || !info.IsDir() {
+			files = append(files, name)
+			continue
+		}
+
+		entries, err := os.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// ReadDir sorts the entries by name, which orders dated logs.
+		for _, entry := range entries {
+			if !entry.IsDir() && (strings.HasSuffix(entry.Name(), ".csv") || strings.HasSuffix(entry.Name(), ".csv.gz")) {
+				files = append(files, filepath.Join(name, entry.Name()))
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// Each calls fn with every sweep recorded in the input files within the time
+// window, in order.
+func (input Input) Each(fn func(*power.Scan) error) error {
+	files, err := input.files()
+	if err != nil {
+		return err
+	}
+
+	from, to, err := input.window()
+	if err != nil {
+		return err
+	}
+
+	inWindow := func(scan *power.Scan) error {
+		if scan.DateTime.Before(from) || (!to.IsZero() && scan.DateTime.After(to)) {
+			return nil
+		}
+		return fn(scan)
+	}
+
+	// the sweeps are handed to fn as they complete, there is no need to
+	// retain more than the two a single push can complete.
+	hm := power_history.New(power_history.MaxSweeps(2))
+
+	for _, name := range files {
+		file, err := open(name)
+		if err != nil {
+			return err
+		}
+
+		reader := power.NewReader(file)
+		reader.Offset = input.Offset
+
+		err = hm.Replay(reader, inWindow)
+		file.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load returns every sweep recorded in the input files.
+func (input Input) Load() ([]*power.Scan, error) {
+	scans := []*power.Scan{}
+
+	err := input.Each(func(scan *power.Scan) error {
+		scans = append(scans, scan)
+		return nil
+	})
+
+	return scans, err
+}
+
+func main() {
+	p := arg.MustParse(&args)
+
+	var err error
+	switch {
+	case args.Render != nil:
+		err = args.Render.Run()
+	case args.Timelapse != nil:
+		err = args.Timelapse.Run()
+	case args.Export != nil:
+		err = args.Export.Run()
+	case args.Occupancy != nil:
+		err = args.Occupancy.Run()
+	case args.Power != nil:
+		err = args.Power.Run()
+	case args.Profile != nil:
+		err = args.Profile.Run()
+	case args.Reference != nil:
+		err = args.Reference.Run()
+	case args.Stats != nil:
+		err = args.Stats.Run()
+	case args.Webhook != nil:
+		err = args.Webhook.Run()
+	default:
+		p.WriteHelp(os.Stderr)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
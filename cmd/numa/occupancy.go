@@ -0,0 +1,137 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	"github.com/olistrik/numa-sdr/api/sdr/power/occupancy"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// OccupancyFlags select when a bin is occupied.
+type OccupancyFlags struct {
+	Threshold       *unit.Decabel `arg:"--threshold" placeholder:"dB" help:"Count bins above this level as occupied, rather than those above the noise."`
+	AboveFloor      *unit.Decabel `arg:"--above-floor" placeholder:"dB" help:"Count bins this far above their own noise floor as occupied, rather than those above the noise."`
+	AboveNoise      unit.Decabel  `arg:"--above-noise" default:"10" placeholder:"dB" help:"Count bins this far above the noise of their sweep as occupied."`
+	NoisePercentile float64       `arg:"--noise-percentile" default:"0.1" placeholder:"float" help:"The percentile of the bins of each sweep taken as its noise."`
+	FloorFlags
+}
+
+// rule returns the occupancy rule selected by the flags.
+func (flags *OccupancyFlags) rule() occupancy.Rule {
+	switch {
+	case flags.Threshold != nil:
+		return occupancy.Threshold(*flags.Threshold)
+	case flags.AboveFloor != nil:
+		return occupancy.AboveFloor(*flags.AboveFloor, flags.floorOptions()...)
+	default:
+		return occupancy.AboveNoise(flags.AboveNoise, flags.NoisePercentile)
+	}
+}
+
+// OccupancyCmd writes the duty cycle of each bin of recorded sweeps as CSV,
+// with a summary of each band and an occupancy heatmap.
+type OccupancyCmd struct {
+	Input
+	WaterfallFlags
+	OccupancyFlags
+
+	Output  string `arg:"-O,--output" placeholder:"file.csv" help:"The file to write the duty cycle of each bin to, with the bands in file.bands.csv. Writes stdout when not given."`
+	Heatmap string `arg:"--heatmap" placeholder:"file.png" help:"Also render the occupancy of each interval as a heatmap."`
+
+	Interval time.Duration `arg:"--interval" default:"10m" placeholder:"duration" help:"The time covered by each row of the heatmap."`
+	Bands    []string      `arg:"--band,separate" placeholder:"name=start:end" help:"A band to summarise, with the frequencies in Hz. May be repeated."`
+}
+
+func (cmd *OccupancyCmd) Run() error {
+	opts := []occupancy.Option{
+		occupancy.Interval(cmd.Interval),
+		occupancy.Occupied(cmd.rule()),
+	}
+
+	bands := make([]band.Band, len(cmd.Bands))
+	for i, value := range cmd.Bands {
+		b, err := band.Parse(value)
+		if err != nil {
+			return err
+		}
+		bands[i] = b
+	}
+	opts = append(opts, occupancy.Bands(bands...))
+
+	// the heatmap is a percentage, drawn from 0 to 100 unless told otherwise.
+	if cmd.Min == nil && cmd.Max == nil {
+		levels := [2]unit.Decabel{0, 100}
+		cmd.Min, cmd.Max = &levels[0], &levels[1]
+	}
+
+	renderOpts, err := cmd.options()
+	if err != nil {
+		return err
+	}
+
+	c := occupancy.New(opts...)
+	skipped := 0
+
+	err = cmd.Each(func(scan *power.Scan) error {
+		if cmd.End > cmd.Start {
+			scan = scan.Slice(cmd.Start, cmd.End)
+		}
+
+		if !c.Add(scan) {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if skipped > 0 {
+		log.Warnf("Skipped %d sweeps whose frequencies differ from the first", skipped)
+	}
+
+	if cmd.Heatmap != "" {
+		img := render.NewWaterfall(renderOpts...).Render(c.Heatmap())
+
+		if err := create(cmd.Heatmap, func(file *os.File) error {
+			return png.Encode(file, img)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if cmd.Output == "" {
+		if err := c.WriteCSV(os.Stdout); err != nil {
+			return err
+		}
+
+		for _, b := range c.Bands() {
+			log.Infof("Band %s: %.2f%% duty cycle, busy %.2f%% of sweeps", b.Name, b.DutyCycle, b.Busy)
+		}
+
+		return nil
+	}
+
+	if err := create(cmd.Output, func(file *os.File) error {
+		return c.WriteCSV(file)
+	}); err != nil {
+		return err
+	}
+
+	if len(bands) == 0 {
+		return nil
+	}
+
+	base := strings.TrimSuffix(cmd.Output, filepath.Ext(cmd.Output))
+	return create(base+".bands.csv", func(file *os.File) error {
+		return c.WriteBandsCSV(file)
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// PowerCmd writes the integrated power of a band in each recorded sweep as
+// CSV, for plotting over time.
+type PowerCmd struct {
+	Input
+
+	Output   string         `arg:"-O,--output" placeholder:"file.csv" help:"The file to write. Writes stdout when not given."`
+	Band     string         `arg:"--band" placeholder:"name=start:end" help:"The band to measure, with the frequencies in Hz."`
+	Start    unit.Frequency `arg:"--start" default:"0" placeholder:"float" help:"Lowest frequency of the band, instead of --band."`
+	End      unit.Frequency `arg:"--end" default:"0" placeholder:"float" help:"Highest frequency of the band, instead of --band."`
+	Interval time.Duration  `arg:"--interval" default:"0" placeholder:"duration" help:"Average the power over each interval, rather than writing every sweep."`
+}
+
+func (cmd *PowerCmd) Run() error {
+	b := band.Band{Name: "window", Start: cmd.Start, End: cmd.End}
+
+	if cmd.Band != "" {
+		var err error
+		if b, err = band.Parse(cmd.Band); err != nil {
+			return err
+		}
+	} else if cmd.End <= cmd.Start {
+		return fmt.Errorf("either --band, or --start and --end, must be given")
+	}
+
+	samples := []band.Sample{}
+
+	err := cmd.Each(func(scan *power.Scan) error {
+		if m, ok := b.Measure(scan); ok {
+			samples = append(samples, band.Sample{Time: scan.DateTime, Measurement: m})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	samples = band.Average(samples, cmd.Interval)
+
+	if cmd.Output == "" {
+		return band.WriteCSV(os.Stdout, samples)
+	}
+
+	return create(cmd.Output, func(file *os.File) error {
+		return band.WriteCSV(file, samples)
+	})
+}
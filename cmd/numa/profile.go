@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/profile"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProfileCmd folds recorded sweeps onto a day or a week, writing the mean
+// power and occupancy of each bin at each time of day or day of the week.
+type ProfileCmd struct {
+	Input
+	WaterfallFlags
+	OccupancyFlags
+
+	Output string         `arg:"-O,--output" placeholder:"file" help:"The file to write: .npz for both matrices, .csv or .png for the one given by --matrix. Writes CSV to stdout when not given."`
+	Period profile.Period `arg:"--period" default:"daily" placeholder:"daily|weekly" help:"Profile the time of day or the day of the week."`
+	Slot   time.Duration  `arg:"--slot" placeholder:"duration" help:"The time covered by each row, which must divide the period. Defaults to an hour of the day or a day of the week."`
+	Matrix string         `arg:"--matrix" default:"mean" placeholder:"mean|occupancy" help:"The matrix written as CSV or PNG."`
+}
+
+// matrix returns the matrix selected by --matrix.
+func (cmd *ProfileCmd) matrix(p *profile.Profile) ([][]float64, error) {
+	switch cmd.Matrix {
+	case "mean":
+		return p.Mean(), nil
+	case "occupancy":
+		return p.Occupancy(), nil
+	default:
+		return nil, fmt.Errorf("unknown matrix %q, expected mean or occupancy", cmd.Matrix)
+	}
+}
+
+func (cmd *ProfileCmd) Run() error {
+	opts := []profile.Option{profile.Occupied(cmd.rule())}
+
+	if cmd.Slot != 0 {
+		opts = append(opts, profile.Slot(cmd.Slot))
+	}
+
+	p, err := profile.New(cmd.Period, opts...)
+	if err != nil {
+		return err
+	}
+
+	// the occupancy is a percentage, drawn from 0 to 100 unless told
+	// otherwise.
+	if cmd.Matrix == "occupancy" && cmd.Min == nil && cmd.Max == nil {
+		levels := [2]unit.Decabel{0, 100}
+		cmd.Min, cmd.Max = &levels[0], &levels[1]
+	}
+
+	renderOpts, err := cmd.options()
+	if err != nil {
+		return err
+	}
+
+	skipped := 0
+
+	err = cmd.Each(func(scan *power.Scan) error {
+		if cmd.End > cmd.Start {
+			scan = scan.Slice(cmd.Start, cmd.End)
+		}
+
+		if !p.Add(scan) {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if skipped > 0 {
+		log.Warnf("Skipped %d sweeps whose frequencies differ from the first", skipped)
+	}
+
+	if filepath.Ext(cmd.Output) == ".npz" {
+		return create(cmd.Output, func(file *os.File) error {
+			return p.WriteNpz(file)
+		})
+	}
+
+	matrix, err := cmd.matrix(p)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(cmd.Output) {
+	case "":
+		return p.WriteCSV(os.Stdout, matrix)
+
+	case ".png":
+		scans, layout := p.Heatmap(matrix)
+		img := render.NewWaterfall(append(renderOpts, render.TimeFormat(layout))...).Render(scans)
+
+		return create(cmd.Output, func(file *os.File) error {
+			return png.Encode(file, img)
+		})
+
+	default:
+		return create(cmd.Output, func(file *os.File) error {
+			return p.WriteCSV(file, matrix)
+		})
+	}
+}
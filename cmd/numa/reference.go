@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/reference"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReferenceCmd averages recorded sweeps into a reference spectrum, which
+// numa_web loads from the references directory of a stream.
+type ReferenceCmd struct {
+	Input
+
+	Output string `arg:"-O,--output,required" placeholder:"file.json" help:"The file to write, named after the reference unless --name is given."`
+	Name   string `arg:"--name" placeholder:"name" help:"The name of the reference."`
+}
+
+func (cmd *ReferenceCmd) Run() error {
+	name := cmd.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(cmd.Output), filepath.Ext(cmd.Output))
+	}
+
+	scans, err := cmd.Load()
+	if err != nil {
+		return err
+	}
+
+	r, err := reference.Capture(name, scans)
+	if err != nil {
+		return err
+	}
+
+	if skipped := len(scans) - r.Sweeps; skipped > 0 {
+		log.Warnf("Skipped %d sweeps whose frequencies differ from the last", skipped)
+	}
+
+	return r.Save(cmd.Output)
+}
+
+// subtractReference replaces each scan with its difference from the
+// reference saved in the file.
+func subtractReference(file string, scans []*power.Scan) error {
+	r, err := reference.Load(file)
+	if err != nil {
+		return err
+	}
+
+	for i, scan := range scans {
+		scans[i] = r.Difference(scan)
+	}
+
+	return nil
+}
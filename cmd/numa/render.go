@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// WaterfallFlags select how sweeps are drawn.
+type WaterfallFlags struct {
+	Width    int            `arg:"-W,--width" default:"800" placeholder:"px"`
+	Height   int            `arg:"-H,--height" default:"600" placeholder:"px"`
+	Colormap string         `arg:"-c,--colormap" default:"viridis" placeholder:"name"`
+	Min      *unit.Decabel  `arg:"--min" placeholder:"dB" help:"Level of the bottom of the colormap. Defaults to auto levels."`
+	Max      *unit.Decabel  `arg:"--max" placeholder:"dB" help:"Level of the top of the colormap. Defaults to auto levels."`
+	Start    unit.Frequency `arg:"--start" default:"0" placeholder:"float" help:"Lowest frequency drawn."`
+	End      unit.Frequency `arg:"--end" default:"0" placeholder:"float" help:"Highest frequency drawn."`
+	Axes     bool           `arg:"--axes" help:"Draw frequency and time axes."`
+}
+
+// options returns the render options selected by the flags.
+func (flags *WaterfallFlags) options() ([]render.Option, error) {
+	cm, ok := render.ColormapByName(flags.Colormap)
+	if !ok {
+		return nil, fmt.Errorf("unknown colormap %q, expected one of %v", flags.Colormap, render.ColormapNames())
+	}
+
+	opts := []render.Option{
+		render.Size(flags.Width, flags.Height),
+		render.WithColormap(cm),
+	}
+
+	if (flags.Min == nil) != (flags.Max == nil) {
+		return nil, fmt.Errorf("--min and --max must be given together")
+	}
+
+	if flags.Min != nil {
+		opts = append(opts, render.Levels(*flags.Min, *flags.Max))
+	}
+
+	if flags.End > flags.Start {
+		opts = append(opts, render.FrequencyRange(flags.Start, flags.End))
+	}
+
+	if flags.Axes {
+		opts = append(opts, render.WithAxes())
+	}
+
+	return opts, nil
+}
+
+type RenderCmd struct {
+	Input
+	WaterfallFlags
+
+	Output    string `arg:"-O,--output,required" placeholder:"file.png"`
+	Reference string `arg:"--reference" placeholder:"file.json" help:"Render the difference from a reference saved by numa reference or numa_web."`
+}
+
+func (cmd *RenderCmd) Run() error {
+	opts, err := cmd.options()
+	if err != nil {
+		return err
+	}
+
+	scans, err := cmd.Load()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Reference != "" {
+		if err := subtractReference(cmd.Reference, scans); err != nil {
+			return err
+		}
+	}
+
+	img := render.NewWaterfall(opts...).Render(scans)
+
+	file, err := os.Create(cmd.Output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, img)
+}
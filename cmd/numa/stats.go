@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/stats"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatsCmd summarises each bin of recorded sweeps as CSV, a row per bin.
+type StatsCmd struct {
+	Input
+
+	Output     string         `arg:"-O,--output" placeholder:"file.csv" help:"The file to write. Writes stdout when not given."`
+	Traces     string         `arg:"--traces" default:"min,median,p95,max,mean" placeholder:"list" help:"The traces to write: min, max, mean, median or a percentile as p95."`
+	Resolution unit.Decabel   `arg:"--resolution" default:"0.1" placeholder:"dB" help:"The resolution of the percentiles, at least 0.01."`
+	Start      unit.Frequency `arg:"--start" default:"0" placeholder:"float" help:"Lowest frequency summarised."`
+	End        unit.Frequency `arg:"--end" default:"0" placeholder:"float" help:"Highest frequency summarised."`
+}
+
+func (cmd *StatsCmd) Run() error {
+	traces := strings.Split(cmd.Traces, ",")
+	if err := stats.ValidTraces(traces); err != nil {
+		return err
+	}
+
+	if !(cmd.Resolution >= stats.MinResolution) || math.IsInf(float64(cmd.Resolution), 0) {
+		return fmt.Errorf("--resolution must be at least %v", stats.MinResolution)
+	}
+
+	s := stats.New(stats.Resolution(cmd.Resolution))
+	skipped := 0
+
+	err := cmd.Each(func(scan *power.Scan) error {
+		if cmd.End > cmd.Start {
+			scan = scan.Slice(cmd.Start, cmd.End)
+		}
+
+		if !s.Add(scan) {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if skipped > 0 {
+		log.Warnf("Skipped %d sweeps whose frequencies differ from the first", skipped)
+	}
+
+	if cmd.Output == "" {
+		return s.WriteCSV(os.Stdout, traces)
+	}
+
+	return create(cmd.Output, func(file *os.File) error {
+		return s.WriteCSV(file, traces)
+	})
+}
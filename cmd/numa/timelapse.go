@@ -0,0 +1,49 @@
+package main
+
+import (
+	"image/gif"
+	"os"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/render"
+)
+
+type TimelapseCmd struct {
+	Input
+	WaterfallFlags
+
+	Output string        `arg:"-O,--output,required" placeholder:"file.gif"`
+	Frames int           `arg:"-n,--frames" default:"60" placeholder:"int"`
+	Delay  time.Duration `arg:"--delay" default:"100ms" placeholder:"duration" help:"How long each frame is shown."`
+	Window time.Duration `arg:"--window" default:"0" placeholder:"duration" help:"Time covered by the waterfall of each frame. Defaults to a quarter of the recording."`
+}
+
+func (cmd *TimelapseCmd) Run() error {
+	opts, err := cmd.options()
+	if err != nil {
+		return err
+	}
+
+	scans, err := cmd.Load()
+	if err != nil {
+		return err
+	}
+
+	anim, err := render.NewTimelapse(
+		render.WithWaterfall(opts...),
+		render.Frames(cmd.Frames),
+		render.FrameDelay(cmd.Delay),
+		render.Window(cmd.Window),
+	).Render(scans)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(cmd.Output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return gif.EncodeAll(file, anim)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookCmd stands in for the receiver of alert webhooks, printing what it
+// is sent, so that alert rules can be tried out locally.
+type WebhookCmd struct {
+	Address string `arg:"-a,--address" default:"127.0.0.1:9000" placeholder:"host:port" help:"The address to listen on."`
+	Status  int    `arg:"--status" default:"204" placeholder:"int" help:"The status to answer with, to try out failing webhooks."`
+}
+
+func (cmd *WebhookCmd) Run() error {
+	log.Infof("Listening for webhooks on http://%s/", cmd.Address)
+
+	return http.ListenAndServe(cmd.Address, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// JSON is indented for reading, anything else is printed as is.
+		var indented bytes.Buffer
+		if json.Indent(&indented, body, "", "  ") == nil {
+			body = indented.Bytes()
+		}
+
+		fmt.Fprintf(os.Stdout, "%s %s %s %s\n%s\n\n", time.Now().Format(time.DateTime), r.Method, r.URL.Path, r.Header.Get("Content-Type"), body)
+
+		w.WriteHeader(cmd.Status)
+	}))
+}
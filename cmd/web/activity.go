@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/sdr/power/detect"
+	"github.com/olistrik/numa-sdr/api/sdr/power/track"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxActivity limits the emissions returned by a search.
+const maxActivity = 100000
+
+// track follows the emissions of the stream, keeping those that ended in the
+// activity log in the stream's directory of the data directory.
+func (p *pipeline) track(dataDir string, opts ...track.Option) error {
+	file, err := dataFile(dataDir, p.Name, "activity.jsonl")
+	if err != nil {
+		return err
+	}
+
+	activity, err := track.OpenLog(file)
+	if err != nil {
+		return err
+	}
+
+	p.tracker = track.New(opts...)
+	p.activity = activity
+
+	return nil
+}
+
+// trackEmissions updates the tracker with the detections of a sweep,
+// logging and broadcasting the emissions that ended as `emission` events.
+func (p *pipeline) trackEmissions(detections []detect.Detection) {
+	if p.tracker == nil {
+		return
+	}
+
+	ended := p.tracker.Update(detections)
+	if len(ended) == 0 {
+		return
+	}
+
+	if err := p.activity.Append(ended...); err != nil {
+		log.Errorf("stream %s: %v", p.Name, err)
+	}
+
+	for _, e := range ended {
+		p.stream.SendEvent(broker.Event{Name: "emission", Value: e})
+	}
+}
+
+// activityQuery reads a search of the activity log from the time window, the
+// `start` and `end` frequencies, and the `min_duration`, `min_peak`, `snr`
+// and `limit` query parameters.
+func (p *pipeline) activityQuery(c *gin.Context) (track.Query, error) {
+	var q track.Query
+	var err error
+
+	if q.From, q.To, err = timeWindow(c, p.hm); err != nil {
+		return q, err
+	}
+
+	if q.Start, q.End, err = frequencyRange(c); err != nil {
+		return q, err
+	}
+
+	if value := c.Query("min_duration"); value != "" {
+		if q.MinDuration, err = time.ParseDuration(value); err != nil {
+			return q, fmt.Errorf("invalid min_duration: %w", err)
+		}
+	}
+
+	if value := c.Query("min_peak"); value != "" {
+		peak, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid min_peak: %w", err)
+		}
+		q.MinPeak = (*unit.Decabel)(&peak)
+	}
+
+	if value := c.Query("snr"); value != "" {
+		snr, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid snr: %w", err)
+		}
+		q.MinSNR = unit.Decabel(snr)
+	}
+
+	if q.Limit, err = queryInt(c, "limit", 1000, maxActivity); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// activityHandler searches the activity log of the stream.
+func (p *pipeline) activityHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.tracker == nil {
+			c.String(http.StatusNotFound, "tracking needs detection, see --detect")
+			return
+		}
+
+		q, err := p.activityQuery(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, p.activity.Search(q))
+	}
+}
+
+// activeHandler lists the emissions that have not yet ended.
+func (p *pipeline) activeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.tracker == nil {
+			c.String(http.StatusNotFound, "tracking needs detection, see --detect")
+			return
+		}
+
+		c.JSON(http.StatusOK, p.tracker.Active())
+	}
+}
+
+// activityCSVHandler serves a search of the activity log as CSV.
+func (p *pipeline) activityCSVHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.tracker == nil {
+			c.String(http.StatusNotFound, "tracking needs detection, see --detect")
+			return
+		}
+
+		q, err := p.activityQuery(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="activity.csv"`)
+		c.Status(http.StatusOK)
+
+		float := func(value float64, precision int) string {
+			return strconv.FormatFloat(value, 'f', precision, 64)
+		}
+
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{
+			"id", "start", "end", "duration_seconds",
+			"frequency_hz", "bandwidth_hz", "min_frequency_hz", "max_frequency_hz",
+			"peak_db", "peak_frequency_hz", "mean_db", "snr_db", "sweeps",
+		})
+
+		for _, e := range p.activity.Search(q) {
+			w.Write([]string{
+				e.ID,
+				e.Start.UTC().Format(time.RFC3339),
+				e.End.UTC().Format(time.RFC3339),
+				float(e.Duration().Seconds(), 0),
+				float(float64(e.Frequency), 0),
+				float(float64(e.Bandwidth), 0),
+				float(float64(e.MinFrequency), 0),
+				float(float64(e.MaxFrequency), 0),
+				float(float64(e.Peak), 2),
+				float(float64(e.PeakFrequency), 0),
+				float(float64(e.Mean), 2),
+				float(float64(e.SNR), 2),
+				strconv.Itoa(e.Sweeps),
+			})
+		}
+
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/annotation"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/auth"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	log "github.com/sirupsen/logrus"
+)
+
+// annotationsHandler lists the annotations overlapping the `from`, `to` or
+// `last` window.
+func (p *pipeline) annotationsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := timeWindow(c, p.hm)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, p.annotations.Within(from, to))
+	}
+}
+
+// createAnnotationHandler stores the annotation in the body and broadcasts it
+// as an `annotation` event. When credentials are required the author is the
+// name they were given for.
+func (p *pipeline) createAnnotationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var a annotation.Annotation
+		if err := c.ShouldBindJSON(&a); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if principal, ok := auth.FromContext(c); ok && principal.Name != "" {
+			a.Author = principal.Name
+		}
+
+		a, err := p.annotations.Add(a)
+		if errors.Is(err, annotation.ErrInvalid) {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			log.Errorln(err)
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		for _, b := range p.brokers() {
+			b.SendEvent(broker.Event{Name: "annotation", Value: a})
+		}
+		c.JSON(http.StatusCreated, a)
+	}
+}
+
+// deleteAnnotationHandler removes an annotation and broadcasts its ID as an
+// `annotation_deleted` event. Viewers may only delete their own annotations.
+func (p *pipeline) deleteAnnotationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		a, ok := p.annotations.Get(id)
+		if !ok {
+			c.String(http.StatusNotFound, annotation.ErrNotFound.Error())
+			return
+		}
+
+		if principal, ok := auth.FromContext(c); !ok || principal.Role < auth.Admin && principal.Name != a.Author {
+			c.String(http.StatusForbidden, "only admins may delete the annotations of others")
+			return
+		}
+
+		if err := p.annotations.Delete(id); err != nil {
+			if errors.Is(err, annotation.ErrNotFound) {
+				c.String(http.StatusNotFound, err.Error())
+				return
+			}
+
+			log.Errorln(err)
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		for _, b := range p.brokers() {
+			b.SendEvent(broker.Event{Name: "annotation_deleted", Value: gin.H{"id": id}})
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
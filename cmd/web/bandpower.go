@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	log "github.com/sirupsen/logrus"
+)
+
+// measureBands returns the sample of each band of the pipeline that the sweep
+// covers, by name.
+func (p *pipeline) measureBands(sweep *power.Scan) map[string]band.Sample {
+	samples := map[string]band.Sample{}
+	for _, b := range p.bands {
+		if m, ok := b.Measure(sweep); ok {
+			samples[b.Name] = band.Sample{Time: sweep.DateTime, Measurement: m}
+		}
+	}
+
+	return samples
+}
+
+// bandPowerBroker returns a broker for the power of the bands of the pipeline,
+// sent to new clients as an `init` event of the series of each band over the
+// history, followed by the annotations, and then as a `power` event per sweep.
+func (p *pipeline) bandPowerBroker() *broker.Broker {
+	return broker.New(
+		broker.OnConnect(func(client *broker.Client) {
+			defer client.SendEvent(broker.Event{Name: "annotations", Value: p.annotations.List()})
+
+			// a reconnecting client only needs the sweeps it missed.
+			if id := client.LastEventID(); id != 0 {
+				if scans, ok := p.hm.Since(id); ok {
+					for i, scan := range scans {
+						client.SendEvent(broker.Event{ID: id + uint64(i) + 1, Name: "power", Value: p.measureBands(scan)})
+					}
+					return
+				}
+			}
+
+			scans, id := p.hm.Snapshot()
+
+			series := map[string][]band.Sample{}
+			for _, b := range p.bands {
+				series[b.Name] = b.Series(scans)
+			}
+
+			client.SendEvent(broker.Event{ID: id, Name: "init", Value: series})
+		}),
+	)
+}
+
+// sendBandPower broadcasts the samples of the bands in a completed sweep.
+func (p *pipeline) sendBandPower(id uint64, samples map[string]band.Sample) {
+	if p.bandPower == nil {
+		return
+	}
+
+	p.bandPower.SendEvent(broker.Event{ID: id, Name: "power", Value: samples})
+}
+
+// queryBand returns the band given by the `band` query parameter, one of the
+// bands of the pipeline, or else by the `start` and `end` frequencies.
+func (p *pipeline) queryBand(c *gin.Context) (band.Band, error) {
+	if name := c.Query("band"); name != "" {
+		for _, b := range p.bands {
+			if b.Name == name {
+				return b, nil
+			}
+		}
+
+		return band.Band{}, fmt.Errorf("unknown band %q, see --band", name)
+	}
+
+	start, end, err := frequencyRange(c)
+	if err != nil {
+		return band.Band{}, err
+	}
+
+	if end <= start {
+		return band.Band{}, fmt.Errorf("either band, or start and end, must be given")
+	}
+
+	return band.Band{Name: "window", Start: start, End: end}, nil
+}
+
+// bandSeries measures the band selected by the query in every sweep of the
+// time window, averaged over each `interval` when it is given.
+func (p *pipeline) bandSeries(c *gin.Context) (band.Band, []band.Sample, error) {
+	b, err := p.queryBand(c)
+	if err != nil {
+		return b, nil, err
+	}
+
+	interval, err := queryDuration(c, "interval", 0)
+	if err != nil {
+		return b, nil, err
+	}
+
+	scans, err := window(c, p.hm)
+	if err != nil {
+		return b, nil, err
+	}
+
+	return b, band.Average(b.Series(scans), interval), nil
+}
+
+// bandPowerInfo is the power of a band over a window of the history.
+type bandPowerInfo struct {
+	Band    band.Band     `json:"band"`
+	Samples []band.Sample `json:"samples"`
+}
+
+// bandPowerHandler serves the integrated power of a band in each sweep, for
+// plotting over time.
+func (p *pipeline) bandPowerHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, samples, err := p.bandSeries(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, bandPowerInfo{Band: b, Samples: samples})
+	}
+}
+
+// bandPowerCSVHandler serves the integrated power of a band as CSV, a row per
+// sweep or interval.
+func (p *pipeline) bandPowerCSVHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, samples, err := p.bandSeries(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", b.Name+".power.csv"))
+		c.Status(http.StatusOK)
+
+		if err := band.WriteCSV(c.Writer, samples); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/detect"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// detectionLog holds the detections of the sweeps in the history, oldest
+// first. A retention of 0 keeps every detection, as the history keeps every
+// sweep.
+type detectionLog struct {
+	mu         sync.RWMutex
+	retention  time.Duration
+	detections []detect.Detection
+}
+
+// add appends the detections of a sweep, dropping those older than the
+// retention before it.
+func (l *detectionLog) add(t time.Time, detections []detect.Detection) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.detections = append(l.detections, detections...)
+
+	if l.retention <= 0 {
+		return
+	}
+
+	cutoff := t.Add(-l.retention)
+	first := sort.Search(len(l.detections), func(i int) bool {
+		return !l.detections[i].Time.Before(cutoff)
+	})
+
+	if first > 0 {
+		l.detections = append(l.detections[:0:0], l.detections[first:]...)
+	}
+}
+
+// window returns the detections within [from, to] and the frequency range,
+// with at least the SNR. Zero values leave that side open.
+func (l *detectionLog) window(from, to time.Time, start, end unit.Frequency, snr unit.Decabel) []detect.Detection {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	first := sort.Search(len(l.detections), func(i int) bool {
+		return !l.detections[i].Time.Before(from)
+	})
+
+	detections := []detect.Detection{}
+	for _, d := range l.detections[first:] {
+		if !to.IsZero() && d.Time.After(to) {
+			break
+		}
+
+		if d.SNR < snr || d.Frequency+d.Bandwidth/2 < start || (end > 0 && d.Frequency-d.Bandwidth/2 > end) {
+			continue
+		}
+
+		detections = append(detections, d)
+	}
+
+	return detections
+}
+
+// detect runs the detector over a completed sweep, broadcasting what it found
+// as a `detections` event, and tracks the emissions.
+func (p *pipeline) detect(sweep *power.Scan) {
+	if p.detector == nil {
+		return
+	}
+
+	detections := p.detector.Detect(sweep)
+	p.detections.add(sweep.DateTime, detections)
+
+	if len(detections) > 0 {
+		p.stream.SendEvent(broker.Event{Name: "detections", Value: detections})
+	}
+
+	p.trackEmissions(detections)
+}
+
+// detectionsHandler lists the detections in the `from`, `to` or `last` window
+// and the `start` and `end` frequency range, with at least the `snr`.
+func (p *pipeline) detectionsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.detector == nil {
+			c.String(http.StatusNotFound, "detection is not enabled, see --detect")
+			return
+		}
+
+		from, to, err := timeWindow(c, p.hm)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		start, end, err := frequencyRange(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var snr float64
+		if value := c.Query("snr"); value != "" {
+			if snr, err = strconv.ParseFloat(value, 64); err != nil {
+				c.String(http.StatusBadRequest, "invalid snr: %v", err)
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, p.detections.window(from, to, start, end, unit.Decabel(snr)))
+	}
+}
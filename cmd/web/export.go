@@ -0,0 +1,158 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/export"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	log "github.com/sirupsen/logrus"
+)
+
+// matrix returns the window and frequency range of the history selected by
+// the query, with the annotations that overlap it.
+func (p *pipeline) matrix(c *gin.Context) (*export.Matrix, error) {
+	scans, err := p.scans(c)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := frequencyRange(c)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := export.NewMatrix(scans, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Annotate(p.annotations.List())
+	return m, nil
+}
+
+// exportHandler serves a window of the history as a download, written by
+// write.
+func (p *pipeline) exportHandler(filename, contentType string, write func(*export.Matrix, io.Writer) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := p.matrix(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if err := write(m, c.Writer); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// npyHandler serves the array of a window of the history named by the `array`
+// query parameter: `power` (the default), `times`, `frequencies` or
+// `annotations`.
+func (p *pipeline) npyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := p.matrix(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		name := c.DefaultQuery("array", "power")
+
+		write := m.WriteNpy
+		switch name {
+		case "power":
+		case "times":
+			write = func(w io.Writer) error { return export.WriteNpy(w, m.Times()) }
+		case "frequencies":
+			write = func(w io.Writer) error { return export.WriteNpy(w, m.Frequencies()) }
+		case "annotations":
+			write = m.WriteAnnotationsNpy
+		default:
+			c.String(http.StatusBadRequest, "unknown array %q, expected power, times, frequencies or annotations", name)
+			return
+		}
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".npy"))
+		if err := write(c.Writer); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// csvHandler streams a window of the history back out as rtl_power CSV, gzip
+// compressed when `gzip` is given. Lines are flushed as they are written so
+// that large windows are not held in memory.
+func (p *pipeline) csvHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scans, err := p.scans(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		start, end, err := frequencyRange(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		compress, err := queryBool(c, "gzip")
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid gzip: %v", err)
+			return
+		}
+
+		var out io.Writer = c.Writer
+		filename := "scans.csv"
+		c.Header("Content-Type", "text/csv")
+
+		if compress {
+			gz := gzip.NewWriter(c.Writer)
+			defer gz.Close()
+
+			out = gz
+			filename += ".gz"
+			c.Header("Content-Type", "application/gzip")
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		// a sweep cut to a frequency range is no longer made of whole hops.
+		w := power.NewWriter(out)
+		if end <= start {
+			w.Hops = p.hm.Hops()
+		}
+
+		for i, scan := range scans {
+			if end > start {
+				scan = scan.Slice(start, end)
+			}
+
+			if err := w.Write(scan); err != nil {
+				log.Errorln(err)
+				return
+			}
+
+			// hand the response over in pieces rather than all at once.
+			if i%100 == 99 {
+				if err := w.Flush(); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/floor"
+)
+
+// estimateFloor enables the noise floor of the stream, with the SNR of its
+// sweeps broadcast on a broker of their own.
+func (p *pipeline) estimateFloor(opts ...floor.Option) {
+	p.floor = floor.New(opts...)
+	p.snr = p.broker(p.snrView)
+}
+
+// snrView returns the SNR of a sweep, or nil for a sweep of another layout
+// than the floor, such as those of the history from before a retune.
+func (p *pipeline) snrView(sweep *power.Scan) *power.Scan {
+	if floor := p.floor.Floor(); floor == nil || !floor.SameLayout(sweep) {
+		return nil
+	}
+
+	return p.floor.SNR(sweep)
+}
+
+// updateFloor adds a completed sweep to the floor, broadcasting the floor as a
+// `floor` event and the SNR of the sweep under the same ID, on the SNR broker
+// alone so that clients of the plain sweeps do not receive the floor too.
+func (p *pipeline) updateFloor(id uint64, sweep *power.Scan) {
+	if p.floor == nil {
+		return
+	}
+
+	p.floor.Push(sweep)
+
+	p.snr.SendEvent(broker.Event{Name: "floor", Value: p.floor.Floor()})
+	p.snr.SendEvent(broker.Event{ID: id, Name: "scan", Value: p.floor.SNR(sweep)})
+}
+
+// floorInfo describes the noise floor of a stream.
+type floorInfo struct {
+	Window     string      `json:"window"`
+	Percentile float64     `json:"percentile"`
+	Sweeps     int         `json:"sweeps"`
+	Floor      *power.Scan `json:"floor"`
+}
+
+// floorHandler serves the current noise floor of each bin, narrowed to the
+// `start` and `end` frequencies.
+func (p *pipeline) floorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.floor == nil {
+			c.String(http.StatusNotFound, "the noise floor is not enabled, see --floor-window")
+			return
+		}
+
+		start, end, err := frequencyRange(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		trace := p.floor.Floor()
+		if trace != nil && end > start {
+			trace = trace.Slice(start, end)
+		}
+
+		c.JSON(http.StatusOK, floorInfo{
+			Window:     p.floor.Window.String(),
+			Percentile: p.floor.Percentile,
+			Sweeps:     p.floor.Sweeps(),
+			Floor:      trace,
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Package auth guards the web server with HTTP basic authentication and
+// bearer tokens.
+//
+// Users are read from an htpasswd style file of `name:bcrypt-hash[:role]`
+// lines, as written by `htpasswd -nB`. Tokens are read from a file of
+// `name:token[:role]` lines. The role is `viewer` when left out. Blank lines
+// and lines starting with # are ignored.
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is what a principal is allowed to do. Each role includes those below
+// it.
+type Role int
+
+const (
+	// Viewer may watch the streams and read the history.
+	Viewer Role = iota + 1
+	// Admin may also use the control endpoints.
+	Admin
+)
+
+func ParseRole(value string) (Role, error) {
+	switch strings.ToLower(value) {
+	case "", "viewer":
+		return Viewer, nil
+	case "admin":
+		return Admin, nil
+	}
+
+	return 0, fmt.Errorf("unknown role %q, expected viewer or admin", value)
+}
+
+func (role Role) String() string {
+	switch role {
+	case Viewer:
+		return "viewer"
+	case Admin:
+		return "admin"
+	}
+
+	return fmt.Sprintf("Role(%d)", int(role))
+}
+
+// Principal is an authenticated user or token.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+// principalKey is the gin context key of the Principal of a request.
+const principalKey = "auth.principal"
+
+// FromContext returns the principal of the request, if any.
+func FromContext(c *gin.Context) (Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+
+	principal, ok := value.(Principal)
+	return principal, ok
+}
+
+type user struct {
+	hash []byte
+	role Role
+}
+
+// Authenticator checks the credentials of requests against the users and
+// tokens files. It is disabled, letting every request through as an admin,
+// when neither is given.
+type Authenticator struct {
+	UsersFile  string
+	TokensFile string
+
+	mu     sync.RWMutex
+	users  map[string]user
+	tokens map[[sha256.Size]byte]Principal
+
+	// verified remembers passwords that matched, as bcrypt is deliberately
+	// too slow to run on every request.
+	verified sync.Map
+}
+
+// New returns an authenticator with the users and tokens files loaded.
+// Either may be empty.
+func New(usersFile, tokensFile string) (*Authenticator, error) {
+	a := &Authenticator{
+		UsersFile:  usersFile,
+		TokensFile: tokensFile,
+	}
+
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// readEntries reads the `name:secret[:role]` lines of a file.
+func readEntries(name string, fn func(name, secret string, role Role) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+			return fmt.Errorf("%s:%d: expected name:secret[:role]", name, number)
+		}
+
+		role := ""
+		if len(fields) == 3 {
+			role = fields[2]
+		}
+
+		parsed, err := ParseRole(role)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, number, err)
+		}
+
+		if err := fn(fields[0], fields[1], parsed); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, number, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Reload reads the users and tokens files again. The current credentials are
+// kept when either cannot be read.
+func (a *Authenticator) Reload() error {
+	users := map[string]user{}
+	tokens := map[[sha256.Size]byte]Principal{}
+
+	if a.UsersFile != "" {
+		err := readEntries(a.UsersFile, func(name, hash string, role Role) error {
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return err
+			}
+
+			users[name] = user{[]byte(hash), role}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.TokensFile != "" {
+		err := readEntries(a.TokensFile, func(name, token string, role Role) error {
+			tokens[sha256.Sum256([]byte(token))] = Principal{name, role}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	a.users = users
+	a.tokens = tokens
+	a.mu.Unlock()
+
+	a.verified.Clear()
+
+	log.Infof("Loaded %d users and %d tokens", len(users), len(tokens))
+	return nil
+}
+
+// Enabled reports whether requests need credentials.
+func (a *Authenticator) Enabled() bool {
+	return a.UsersFile != "" || a.TokensFile != ""
+}
+
+// password checks a basic authentication password.
+func (a *Authenticator) password(name, password string) (Principal, bool) {
+	a.mu.RLock()
+	u, ok := a.users[name]
+	a.mu.RUnlock()
+
+	if !ok {
+		return Principal{}, false
+	}
+
+	key := sha256.Sum256([]byte(name + "\x00" + password + "\x00" + string(u.hash)))
+	if _, ok := a.verified.Load(key); !ok {
+		if bcrypt.CompareHashAndPassword(u.hash, []byte(password)) != nil {
+			return Principal{}, false
+		}
+		a.verified.Store(key, struct{}{})
+	}
+
+	return Principal{name, u.role}, true
+}
+
+// token checks a bearer token. Tokens are looked up by their digest so that
+// the lookup does not leak how much of a token matched.
+func (a *Authenticator) token(token string) (Principal, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	principal, ok := a.tokens[sha256.Sum256([]byte(token))]
+	return principal, ok
+}
+
+// authenticate returns the principal of the request's credentials: basic
+// authentication, a bearer token, or an `access_token` query parameter for
+// clients such as EventSource that cannot set headers.
+func (a *Authenticator) authenticate(r *http.Request) (Principal, bool) {
+	if name, password, ok := r.BasicAuth(); ok {
+		return a.password(name, password)
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.token(strings.TrimSpace(token))
+	}
+
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return a.token(token)
+	}
+
+	return Principal{}, false
+}
+
+// RedactQuery replaces the `access_token` query parameter of a path, as
+// logged, so that tokens do not end up in logs.
+func RedactQuery(path string) string {
+	base, raw, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		// a query that cannot be parsed cannot be redacted either.
+		return base
+	}
+
+	if query.Has("access_token") {
+		query.Set("access_token", "REDACTED")
+	}
+
+	return base + "?" + query.Encode()
+}
+
+// Require rejects requests without credentials for at least the role.
+func (a *Authenticator) Require(role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Enabled() {
+			c.Set(principalKey, Principal{Role: Admin})
+			return
+		}
+
+		principal, ok := a.authenticate(c.Request)
+		if !ok {
+			if a.UsersFile != "" {
+				c.Header("WWW-Authenticate", `Basic realm="numa", charset="UTF-8"`)
+			}
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if principal.Role < role {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Set(principalKey, principal)
+	}
+}
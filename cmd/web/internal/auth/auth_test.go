@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// write writes the lines to a file of the test's temporary directory.
+func write(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := write(t, "users", "# users\n\nada:"+string(hash)+":admin\nvic:"+string(hash)+"\n")
+	tokens := write(t, "tokens", "ci:t0ken\nops:adm1n:admin\n")
+
+	tests := []struct {
+		name      string
+		users     string
+		tokens    string
+		role      Role
+		request   func(r *http.Request)
+		status    int
+		principal Principal
+	}{
+		{
+			name:      "disabled",
+			role:      Admin,
+			status:    http.StatusOK,
+			principal: Principal{Role: Admin},
+		},
+		{
+			name:   "no credentials",
+			users:  users,
+			role:   Viewer,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:      "basic",
+			users:     users,
+			role:      Viewer,
+			request:   func(r *http.Request) { r.SetBasicAuth("vic", "secret") },
+			status:    http.StatusOK,
+			principal: Principal{"vic", Viewer},
+		},
+		{
+			name:    "wrong password",
+			users:   users,
+			role:    Viewer,
+			request: func(r *http.Request) { r.SetBasicAuth("vic", "guess") },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "unknown user",
+			users:   users,
+			role:    Viewer,
+			request: func(r *http.Request) { r.SetBasicAuth("eve", "secret") },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "below the role",
+			users:   users,
+			role:    Admin,
+			request: func(r *http.Request) { r.SetBasicAuth("vic", "secret") },
+			status:  http.StatusForbidden,
+		},
+		{
+			name:      "admin",
+			users:     users,
+			role:      Admin,
+			request:   func(r *http.Request) { r.SetBasicAuth("ada", "secret") },
+			status:    http.StatusOK,
+			principal: Principal{"ada", Admin},
+		},
+		{
+			name:      "bearer",
+			tokens:    tokens,
+			role:      Viewer,
+			request:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") },
+			status:    http.StatusOK,
+			principal: Principal{"ci", Viewer},
+		},
+		{
+			name:    "unknown bearer",
+			tokens:  tokens,
+			role:    Viewer,
+			request: func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ke") },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:      "access token",
+			users:     users,
+			tokens:    tokens,
+			role:      Admin,
+			request:   func(r *http.Request) { r.URL.RawQuery = "access_token=adm1n" },
+			status:    http.StatusOK,
+			principal: Principal{"ops", Admin},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := New(test.users, test.tokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var principal Principal
+			r := gin.New()
+			r.GET("/", a.Require(test.role), func(c *gin.Context) {
+				principal, _ = FromContext(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.request != nil {
+				test.request(req)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+
+			if principal != test.principal {
+				t.Errorf("principal %+v, want %+v", principal, test.principal)
+			}
+
+			if challenge := w.Header().Get("WWW-Authenticate"); (challenge != "") != (w.Code == http.StatusUnauthorized && test.users != "") {
+				t.Errorf("WWW-Authenticate is %q with status %d", challenge, w.Code)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{name: "roles", content: "a:x\nb:y:viewer\nc:z:ADMIN\n"},
+		{name: "comments", content: "# a comment\n\n  \nd:w\n"},
+		{name: "no secret", content: "a:\n", err: true},
+		{name: "no name", content: ":x\n", err: true},
+		{name: "too many fields", content: "a:x:admin:more\n", err: true},
+		{name: "unknown role", content: "a:x:root\n", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New("", write(t, "tokens", test.content))
+			if (err != nil) != test.err {
+				t.Errorf("error %v, want an error: %v", err, test.err)
+			}
+		})
+	}
+
+	if _, err := New(write(t, "users", "a:not-a-hash\n"), ""); err == nil {
+		t.Errorf("a user without a bcrypt hash was loaded")
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/stream/scans", "/stream/scans"},
+		{"/stream/scans?last=1h", "/stream/scans?last=1h"},
+		{"/stream/scans?access_token=t0ken&last=1h", "/stream/scans?access_token=REDACTED&last=1h"},
+		{"/stream/scans?access_token=%zz", "/stream/scans"},
+	}
+
+	for _, test := range tests {
+		if got := RedactQuery(test.path); got != test.want {
+			t.Errorf("RedactQuery(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package broker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultEncoding is the value encoding used when a client does not request
+// one.
+const DefaultEncoding = "json"
+
+// clientBuffer is the number of broadcasts queued for a client before
+// further broadcasts are dropped.
+const clientBuffer = 64
+
+type Event struct {
+	// ID orders the event for clients that resume a stream, 0 if it has none.
+	ID    uint64
+	Name  string
+	Value any
+}
+
+// Encoder serialises the value of an event.
+type Encoder func(value any) ([]byte, error)
+
+// Message is an event serialised for a particular transport.
+type Message struct {
+	ID     uint64
+	Data   []byte
+	Binary bool
+}
+
+// Format serialises events into messages for a transport. Clients that share
+// a format by name, and a subscription, also share the serialised messages, so
+// the name must capture everything that affects the output of Encode.
+type Format struct {
+	Name   string
+	Encode func(event Event) (Message, error)
+}
+
+// broadcast is an event being sent to every client. It is serialised at most
+// once per format, no matter how many clients receive it.
+type broadcast struct {
+	Event
+	encoded map[string]Message
+}
+
+type Client struct {
+	broker      *Broker
+	id          string
+	lastEventID uint64
+
+	// backlog holds the messages sent by the connect callback, they are
+	// delivered before any broadcast.
+	backlog []Message
+	// replayed is the highest ID in the backlog. Broadcasts up to it are
+	// duplicates and are skipped.
+	replayed uint64
+
+	messages chan Message
+	output   chan Message
+	closed   sync.Once
+
+	mu           sync.Mutex
+	format       Format
+	events       []string
+	subscription Subscription
+}
+
+// ID returns the random identifier of the client, used to change its
+// subscription.
+func (client *Client) ID() string {
+	return client.id
+}
+
+// Send serialises the event for this client alone and queues it. It may only
+// be called from the connect callback.
+func (client *Client) Send(name string, value any) {
+	client.SendEvent(Event{Name: name, Value: value})
+}
+
+// SendEvent is Send for an event with an ID.
+func (client *Client) SendEvent(event Event) {
+	event.Value = client.Subscription().apply(event.Value)
+
+	msg, err := client.Format().Encode(event)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	msg.ID = event.ID
+	client.backlog = append(client.backlog, msg)
+	client.replayed = max(client.replayed, event.ID)
+}
+
+// LastEventID returns the ID of the last event the client received before it
+// reconnected, 0 for a new client.
+func (client *Client) LastEventID() uint64 {
+	return client.lastEventID
+}
+
+// Messages returns the channel of messages queued for the client. It is
+// closed once the client has been removed from the broker.
+func (client *Client) Messages() <-chan Message {
+	return client.output
+}
+
+// deliver forwards the backlog and then the broadcasts to the output.
+func (client *Client) deliver() {
+	defer close(client.output)
+
+	for _, msg := range client.backlog {
+		client.output <- msg
+	}
+	client.backlog = nil
+
+	for msg := range client.messages {
+		if msg.ID != 0 && msg.ID <= client.replayed {
+			continue
+		}
+
+		client.output <- msg
+	}
+}
+
+// Format returns the format the client currently receives messages in.
+func (client *Client) Format() Format {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.format
+}
+
+// SetFormat changes the format of any subsequent messages.
+func (client *Client) SetFormat(format Format) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.format = format
+}
+
+// Subscription returns the part of each sweep the client receives.
+func (client *Client) Subscription() Subscription {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.subscription
+}
+
+// SetSubscription changes the part of each subsequent sweep the client
+// receives.
+func (client *Client) SetSubscription(sub Subscription) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.subscription = sub
+}
+
+// SetEvents restricts the broadcast events the client receives to the given
+// names. Without any names the client receives every event.
+func (client *Client) SetEvents(names ...string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.events = names
+}
+
+// Subscribed reports whether the client receives broadcasts of the event.
+func (client *Client) Subscribed(name string) bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return len(client.events) == 0 || slices.Contains(client.events, name)
+}
+
+// Close removes the client from the broker and discards any messages still
+// queued for it. It is safe to call more than once.
+func (client *Client) Close() {
+	client.closed.Do(func() {
+		client.broker.clients.Delete(client.id)
+
+		// Send closed connection to event stream
+		client.broker.ClosedClients <- client
+
+		// Drain client channel so that it does not block. Server may keep sending messages to this channel
+		for range client.output {
+		}
+	})
+}
+
+// It keeps a list of clients those are currently attached
+// and broadcasting events to those clients.
+type Broker struct {
+	// Events are pushed to this channel by the main events-gathering routine
+	events chan Event
+
+	// New client connections
+	NewClients chan *Client
+
+	// Closed client connections
+	ClosedClients chan *Client
+
+	// Total client connections
+	TotalClients map[*Client]bool
+
+	// clients maps the ID of every connected client to the client.
+	clients sync.Map
+
+	// dropped counts the messages not delivered to clients that fell behind.
+	dropped atomic.Uint64
+
+	encoders        map[string]Encoder
+	connectCallback func(client *Client)
+}
+
+type Option func(broker *Broker)
+
+func OnConnect(callback func(*Client)) Option {
+	return func(broker *Broker) {
+		broker.connectCallback = callback
+	}
+}
+
+// Encoding registers a value encoder that transports can offer to their
+// clients.
+func Encoding(name string, encoder Encoder) Option {
+	return func(broker *Broker) {
+		broker.encoders[name] = encoder
+	}
+}
+
+// Initialize event and Start processing requests
+func New(options ...Option) *Broker {
+	broker := &Broker{
+		events:        make(chan Event),
+		NewClients:    make(chan *Client),
+		ClosedClients: make(chan *Client),
+		TotalClients:  make(map[*Client]bool),
+		encoders: map[string]Encoder{
+			DefaultEncoding: json.Marshal,
+		},
+	}
+
+	for _, opt := range options {
+		opt(broker)
+	}
+
+	go broker.listen()
+
+	return broker
+}
+
+// Encoder returns the value encoder registered under the name.
+func (broker *Broker) Encoder(name string) (Encoder, bool) {
+	encoder, ok := broker.encoders[name]
+	return encoder, ok
+}
+
+// Lookup returns the connected client with the given ID.
+func (broker *Broker) Lookup(id string) (*Client, bool) {
+	client, ok := broker.clients.Load(id)
+	if !ok {
+		return nil, false
+	}
+
+	return client.(*Client), true
+}
+
+// Dropped returns the number of messages dropped because a client fell
+// behind.
+func (broker *Broker) Dropped() uint64 {
+	return broker.dropped.Load()
+}
+
+// Clients returns the number of connected clients.
+func (broker *Broker) Clients() int {
+	n := 0
+	broker.clients.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+
+	return n
+}
+
+// Subscribe registers a new client that receives messages in the given
+// format and subscription. A client resuming a stream passes the ID of the
+// last event it received, otherwise 0.
+func (broker *Broker) Subscribe(format Format, sub Subscription, lastEventID uint64) *Client {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	client := &Client{
+		broker:       broker,
+		id:           hex.EncodeToString(id),
+		lastEventID:  lastEventID,
+		messages:     make(chan Message, clientBuffer),
+		output:       make(chan Message),
+		format:       format,
+		subscription: sub,
+	}
+
+	broker.clients.Store(client.id, client)
+
+	// Send new connection to event stream
+	broker.NewClients <- client
+
+	// The callback runs once the client is registered, so any broadcast it
+	// does not account for is already queued.
+	if broker.connectCallback != nil {
+		broker.connectCallback(client)
+	}
+
+	go client.deliver()
+
+	return client
+}
+
+// It Listens all incoming requests from clients.
+// Handles addition and removal of clients and broadcast messages to clients.
+func (broker *Broker) listen() {
+	for {
+		select {
+		// Add new available client
+		case client := <-broker.NewClients:
+			broker.TotalClients[client] = true
+			log.Printf("Client added. %d registered clients", len(broker.TotalClients))
+
+		// Remove closed client
+		case client := <-broker.ClosedClients:
+			delete(broker.TotalClients, client)
+			close(client.messages)
+			log.Printf("Removed client. %d registered clients", len(broker.TotalClients))
+
+		// Broadcast message to client
+		case event := <-broker.events:
+			msg := &broadcast{event, map[string]Message{}}
+
+			for client := range broker.TotalClients {
+				if !client.Subscribed(event.Name) {
+					continue
+				}
+
+				data, err := msg.encode(client.Format(), client.Subscription())
+				if err != nil {
+					log.Errorln(err)
+					continue
+				}
+
+				select {
+				case client.messages <- data:
+					// Message sent successfully
+				default:
+					// Failed to send, dropping message
+					broker.dropped.Add(1)
+				}
+			}
+		}
+	}
+}
+
+// encode returns the broadcast narrowed to the subscription and serialised in
+// the given format, reusing the result of any earlier call.
+func (msg *broadcast) encode(format Format, sub Subscription) (Message, error) {
+	key := format.Name + "|" + sub.key()
+	if data, ok := msg.encoded[key]; ok {
+		return data, nil
+	}
+
+	event := msg.Event
+	event.Value = sub.apply(event.Value)
+
+	data, err := format.Encode(event)
+	if err != nil {
+		return Message{}, err
+	}
+
+	data.ID = msg.ID
+	msg.encoded[key] = data
+	return data, nil
+}
+
+func (broker *Broker) Send(name string, value any) {
+	broker.SendEvent(Event{Name: name, Value: value})
+}
+
+// SendEvent is Send for an event with an ID.
+func (broker *Broker) SendEvent(event Event) {
+	broker.events <- event
+}
@@ -0,0 +1,127 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Subscription limits the scans sent to a client to a frequency window,
+// decimated to a maximum number of columns. The zero value receives every
+// bin of every sweep.
+type Subscription struct {
+	Start   unit.Frequency `json:"start"`
+	End     unit.Frequency `json:"end"`
+	Columns int            `json:"columns"`
+}
+
+// key identifies the subscription when sharing serialised broadcasts.
+func (sub Subscription) key() string {
+	return fmt.Sprintf("%v:%v/%d", float64(sub.Start), float64(sub.End), sub.Columns)
+}
+
+// scan returns the part of the scan covered by the subscription. A window
+// without an end runs to the end of the sweep.
+func (sub Subscription) scan(scan *power.Scan) *power.Scan {
+	if sub.Start != 0 || sub.End != 0 {
+		end := sub.End
+		if end == 0 {
+			end = scan.EndFrequency
+		}
+		scan = scan.Slice(sub.Start, end)
+	}
+
+	return scan.Decimate(sub.Columns)
+}
+
+// apply narrows any scans in an event value to the subscription.
+func (sub Subscription) apply(value any) any {
+	if sub == (Subscription{}) {
+		return value
+	}
+
+	switch value := value.(type) {
+	case *power.Scan:
+		return sub.scan(value)
+	case []*power.Scan:
+		scans := make([]*power.Scan, len(value))
+		for i, scan := range value {
+			scans[i] = sub.scan(scan)
+		}
+		return scans
+	default:
+		return value
+	}
+}
+
+// ParseSubscription reads a subscription from the `start`, `end` and
+// `columns` query parameters. Missing parameters are left at zero.
+func ParseSubscription(query url.Values) (Subscription, error) {
+	var sub Subscription
+
+	if value := query.Get("start"); value != "" {
+		if err := sub.Start.UnmarshalText([]byte(value)); err != nil {
+			return sub, fmt.Errorf("invalid start: %w", err)
+		}
+	}
+
+	if value := query.Get("end"); value != "" {
+		if err := sub.End.UnmarshalText([]byte(value)); err != nil {
+			return sub, fmt.Errorf("invalid end: %w", err)
+		}
+	}
+
+	if value := query.Get("columns"); value != "" {
+		columns, err := strconv.Atoi(value)
+		if err != nil {
+			return sub, fmt.Errorf("invalid columns: %w", err)
+		}
+		sub.Columns = columns
+	}
+
+	return sub, sub.Validate()
+}
+
+// Validate reports whether the subscription describes a usable window.
+func (sub Subscription) Validate() error {
+	if sub.End != 0 && sub.End <= sub.Start {
+		return fmt.Errorf("end must be above start")
+	}
+
+	if sub.Columns < 0 {
+		return fmt.Errorf("columns must not be negative")
+	}
+
+	return nil
+}
+
+// SubscriptionHandler replaces the subscription of the client named by the
+// `id` path parameter with the JSON subscription in the request body.
+func (broker *Broker) SubscriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := broker.Lookup(c.Param("id"))
+		if !ok {
+			c.String(http.StatusNotFound, "unknown client %q", c.Param("id"))
+			return
+		}
+
+		var sub Subscription
+		if err := c.ShouldBindJSON(&sub); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := sub.Validate(); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		client.SetSubscription(sub)
+		c.JSON(http.StatusOK, sub)
+	}
+}
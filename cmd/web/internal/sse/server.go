@@ -1,138 +1,131 @@
 package sse
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
 )
 
-type Event struct {
-	Name  string
-	Value any
-}
-
-type Client chan Event
-
-func (client Client) Send(name string, value any) {
-	client <- Event{name, value}
-}
-
-// It keeps a list of clients those are currently attached
-// and broadcasting events to those clients.
-type Stream struct {
-	// Events are pushed to this channel by the main events-gathering routine
-	events chan Event
-
-	// New client connections
-	NewClients chan Client
-
-	// Closed client connections
-	ClosedClients chan Client
-
-	// Total client connections
-	TotalClients map[Client]bool
-
-	connectCallback func(client Client)
-}
+// format returns the broker format that renders events as SSE messages with
+// the given value encoder.
+func format(name string, encoder broker.Encoder) broker.Format {
+	return broker.Format{
+		Name: "sse/" + name,
+		Encode: func(event broker.Event) (broker.Message, error) {
+			data, err := encoder(event.Value)
+			if err != nil {
+				return broker.Message{}, err
+			}
 
-type StreamOption func(stream *Stream)
+			var buffer bytes.Buffer
+			if event.ID != 0 {
+				fmt.Fprintf(&buffer, "id:%d\n", event.ID)
+			}
+			fmt.Fprintf(&buffer, "event:%s\n", event.Name)
+			for _, line := range bytes.Split(data, []byte("\n")) {
+				fmt.Fprintf(&buffer, "data:%s\n", line)
+			}
+			buffer.WriteByte('\n')
 
-func OnConnect(callback func(Client)) StreamOption {
-	return func(stream *Stream) {
-		stream.connectCallback = callback
+			return broker.Message{Data: buffer.Bytes()}, nil
+		},
 	}
 }
 
-// Initialize event and Start processing requests
-func NewStream(options ...StreamOption) *Stream {
-	stream := &Stream{
-		events:        make(chan Event),
-		NewClients:    make(chan Client),
-		ClosedClients: make(chan Client),
-		TotalClients:  make(map[Client]bool),
-	}
-
-	for _, opt := range options {
-		opt(stream)
+// acceptsGzip reports whether the request negotiated a gzip response.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, _, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(name) == "gzip" {
+			return true
+		}
 	}
 
-	go stream.listen()
-
-	return stream
+	return false
 }
 
-// It Listens all incoming requests from clients.
-// Handles addition and removal of clients and broadcast messages to clients.
-func (stream *Stream) listen() {
-	for {
-		select {
-		// Add new available client
-		case client := <-stream.NewClients:
-			stream.TotalClients[client] = true
-			log.Printf("Client added. %d registered clients", len(stream.TotalClients))
-
-		// Remove closed client
-		case client := <-stream.ClosedClients:
-			delete(stream.TotalClients, client)
-			close(client)
-			log.Printf("Removed client. %d registered clients", len(stream.TotalClients))
-
-		// Broadcast message to client
-		case eventMsg := <-stream.events:
-			for clientMessageChan := range stream.TotalClients {
-				select {
-				case clientMessageChan <- eventMsg:
-					// Message sent successfully
-				default:
-					// Failed to send, dropping message
-				}
-			}
+// Handler streams the events of the broker to the client as server-sent
+// events. The value encoding is selected with the `encoding` query parameter,
+// and the subscription with the `start`, `end` and `columns` query parameters.
+// A reconnecting client resumes from its `Last-Event-ID` header.
+//
+// The first event, `client`, carries the ID under which the subscription can
+// be changed without reconnecting.
+func Handler(b *broker.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := c.DefaultQuery("encoding", broker.DefaultEncoding)
+		encoder, ok := b.Encoder(encoding)
+		if !ok {
+			c.String(http.StatusBadRequest, "unknown encoding %q", encoding)
+			return
 		}
-	}
-}
 
-// New event messages are broadcast to all registered client connection channels
-func (stream *Stream) Handler() gin.HandlerFunc {
-	return func(c *gin.Context) {
+		sub, err := broker.ParseSubscription(c.Request.URL.Query())
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// EventSource resends the ID of the last event it saw when it reconnects.
+		// A malformed ID is treated as a new connection.
+		lastEventID, _ := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+
 		// Set headers
 		c.Writer.Header().Set("Content-Type", "text/event-stream")
 		c.Writer.Header().Set("Cache-Control", "no-cache")
 		c.Writer.Header().Set("Connection", "keep-alive")
 		c.Writer.Header().Set("Transfer-Encoding", "chunked")
+		c.Writer.Header().Set("Vary", "Accept-Encoding")
 
-		// Initialize client channel
-		client := make(Client)
-		if stream.connectCallback != nil {
-			go stream.connectCallback(client)
-		}
+		var out io.Writer = c.Writer
+		flush := func() {}
 
-		// Send new connection to event stream
-		stream.NewClients <- client
+		// Compress the whole stream when the client supports it. Each message
+		// is flushed through the compressor so it is not held back.
+		if acceptsGzip(c.Request) {
+			c.Writer.Header().Set("Content-Encoding", "gzip")
 
-		go func() {
-			<-c.Writer.CloseNotify()
+			gz := gzip.NewWriter(c.Writer)
+			defer gz.Close()
 
-			// Send closed connection to event stream
-			stream.ClosedClients <- client
+			out = gz
+			flush = func() { gz.Flush() }
+		}
 
-			// Drain client channel so that it does not block. Server may keep sending messages to this channel
-			for range client {
-			}
+		client := b.Subscribe(format(encoding, encoder), sub, lastEventID)
 
+		hello, err := format(broker.DefaultEncoding, json.Marshal).Encode(broker.Event{
+			Name:  "client",
+			Value: gin.H{"id": client.ID()},
+		})
+		if err == nil {
+			out.Write(hello.Data)
+			flush()
+		}
+
+		go func() {
+			<-c.Writer.CloseNotify()
+			client.Close()
 		}()
 
 		c.Stream(func(w io.Writer) bool {
 			// Stream message to client from message channel
-			if msg, ok := <-client; ok {
-				c.SSEvent(msg.Name, msg.Value)
+			if msg, ok := <-client.Messages(); ok {
+				if _, err := out.Write(msg.Data); err != nil {
+					return false
+				}
+				flush()
 				return true
 			}
 			return false
 		})
 	}
 }
-
-func (stream *Stream) Send(name string, value any) {
-	stream.events <- Event{name, value}
-}
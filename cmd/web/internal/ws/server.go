@@ -0,0 +1,243 @@
+// Package ws streams broker events over a WebSocket.
+//
+// Scans are sent as little-endian binary frames:
+//
+//	offset  size  field
+//	0       1     version, currently 1
+//	1       1     kind, 1 for a `scan` event, 2 for an `init` event and 3 for a
+//	              `floor` event
+//	2       1     sample type, 1 for float32 and 2 for int16
+//	3       1     reserved
+//	4       4     number of scans that follow (uint32)
+//	8       8     event ID (uint64), the ID of the last scan for `init`
+//
+// followed by that many scans, each made of:
+//
+//	0       8     date time in unix milliseconds (int64)
+//	8       8     start frequency in Hz (float64)
+//	16      8     end frequency in Hz (float64)
+//	24      4     scale in dB per unit (float32), 1 for float32 samples
+//	28      4     number of bins (uint32)
+//	32      ...   bins, 4 bytes each for float32 and 2 bytes each for int16
+//
+// Every other event is sent as a JSON text frame `{"event": ..., "data": ...}`.
+//
+// Clients can send JSON text frames to control the stream:
+//
+//	{"type": "subscribe", "events": ["scan"]}
+//	{"type": "viewport", "start": 88e6, "end": 90e6, "columns": 512}
+//
+// An empty subscription receives every event, and an empty viewport receives
+// the whole sweep.
+//
+// A client resuming after a dropped connection passes the last event ID it
+// received as `?lastEventId=`, and is sent only the scans it missed when they
+// are still retained.
+package ws
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	log "github.com/sirupsen/logrus"
+)
+
+const version = 1
+
+const (
+	kindScan  = 1
+	kindInit  = 2
+	kindFloor = 3
+)
+
+// SampleType is the representation of the bins in a binary frame.
+type SampleType byte
+
+const (
+	Float32 SampleType = 1
+	Int16   SampleType = 2
+)
+
+// int16Scale is the resolution of int16 samples, in dB.
+const int16Scale = 0.01
+
+var sampleTypes = map[string]SampleType{
+	"float32": Float32,
+	"int16":   Int16,
+}
+
+type control struct {
+	Type   string   `json:"type"`
+	Events []string `json:"events"`
+	broker.Subscription
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// writeScan appends the binary representation of a scan to the buffer.
+func writeScan(buffer *bytes.Buffer, scan *power.Scan, samples SampleType) {
+	scale := float32(1)
+	if samples == Int16 {
+		scale = int16Scale
+	}
+
+	binary.Write(buffer, binary.LittleEndian, scan.DateTime.UnixMilli())
+	binary.Write(buffer, binary.LittleEndian, float64(scan.StartFrequency))
+	binary.Write(buffer, binary.LittleEndian, float64(scan.EndFrequency))
+	binary.Write(buffer, binary.LittleEndian, scale)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(scan.Bins)))
+
+	for _, bin := range scan.Bins {
+		switch samples {
+		case Int16:
+			value := math.Round(float64(bin) / int16Scale)
+			if math.IsNaN(value) {
+				value = 0
+			}
+			binary.Write(buffer, binary.LittleEndian, int16(max(math.MinInt16, min(math.MaxInt16, value))))
+		default:
+			binary.Write(buffer, binary.LittleEndian, float32(bin))
+		}
+	}
+}
+
+// encodeScans renders the scans as a binary frame.
+func encodeScans(kind byte, id uint64, scans []*power.Scan, samples SampleType) []byte {
+	var buffer bytes.Buffer
+
+	buffer.Write([]byte{version, kind, byte(samples), 0})
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(scans)))
+	binary.Write(&buffer, binary.LittleEndian, id)
+
+	for _, scan := range scans {
+		writeScan(&buffer, scan, samples)
+	}
+
+	return buffer.Bytes()
+}
+
+// format returns the broker format for clients with the given sample type.
+func format(samples SampleType) broker.Format {
+	return broker.Format{
+		Name: fmt.Sprintf("ws/%d", samples),
+		Encode: func(event broker.Event) (broker.Message, error) {
+			switch value := event.Value.(type) {
+			case *power.Scan:
+				kind := byte(kindScan)
+				if event.Name == "floor" {
+					kind = kindFloor
+				}
+				return broker.Message{Data: encodeScans(kind, event.ID, []*power.Scan{value}, samples), Binary: true}, nil
+			case []*power.Scan:
+				return broker.Message{Data: encodeScans(kindInit, event.ID, value, samples), Binary: true}, nil
+			}
+
+			data, err := json.Marshal(struct {
+				Event string `json:"event"`
+				Data  any    `json:"data"`
+			}{event.Name, event.Value})
+
+			return broker.Message{Data: data}, err
+		},
+	}
+}
+
+// handle applies a control message received from the client.
+func handle(client *broker.Client, data []byte) error {
+	var msg control
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		client.SetEvents(msg.Events...)
+	case "viewport":
+		if err := msg.Subscription.Validate(); err != nil {
+			return err
+		}
+		client.SetSubscription(msg.Subscription)
+	default:
+		return fmt.Errorf("unknown control message %q", msg.Type)
+	}
+
+	return nil
+}
+
+// Handler upgrades the request to a WebSocket and streams the events of the
+// broker over it. The sample type of binary frames is selected with the
+// `samples` query parameter, the initial viewport with the `start`, `end` and
+// `columns` query parameters, and a reconnecting client resumes from the
+// `lastEventId` query parameter.
+func Handler(b *broker.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.DefaultQuery("samples", "float32")
+		samples, ok := sampleTypes[name]
+		if !ok {
+			c.String(http.StatusBadRequest, "unknown sample type %q", name)
+			return
+		}
+
+		sub, err := broker.ParseSubscription(c.Request.URL.Query())
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// A malformed ID is treated as a new connection.
+		lastEventID, _ := strconv.ParseUint(c.Query("lastEventId"), 10, 64)
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// the upgrader has already replied to the client.
+			log.Errorln(err)
+			return
+		}
+		defer conn.Close()
+
+		client := b.Subscribe(format(samples), sub, lastEventID)
+
+		go func() {
+			defer client.Close()
+
+			for {
+				kind, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+
+				if kind != websocket.TextMessage {
+					continue
+				}
+
+				if err := handle(client, data); err != nil {
+					log.Errorln(err)
+				}
+			}
+		}()
+
+		for msg := range client.Messages() {
+			kind := websocket.TextMessage
+			if msg.Binary {
+				kind = websocket.BinaryMessage
+			}
+
+			if err := conn.WriteMessage(kind, msg.Data); err != nil {
+				// closing the connection stops the reader, which closes the client.
+				conn.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+)
+
+// exposition writes metrics in the Prometheus text format.
+type exposition struct {
+	bytes.Buffer
+}
+
+// family starts a metric family, which must be given all of its samples
+// before the next begins.
+func (e *exposition) family(name, kind, help string) {
+	fmt.Fprintf(e, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(e, "# TYPE %s %s\n", name, kind)
+}
+
+// sample writes a sample, with the labels given as pairs of name and value.
+func (e *exposition) sample(name string, value float64, labels ...string) {
+	e.WriteString(name)
+
+	if len(labels) > 0 {
+		e.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				e.WriteByte(',')
+			}
+			fmt.Fprintf(e, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		e.WriteByte('}')
+	}
+
+	e.WriteByte(' ')
+	e.WriteString(formatSample(value))
+	e.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatSample(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsSnapshot is what the metrics report of a pipeline, read at once so
+// that every family sees the same state.
+type metricsSnapshot struct {
+	status
+	lastSweep float64
+	bands     map[string]band.Measurement
+}
+
+func (p *pipeline) metrics() metricsSnapshot {
+	snapshot := metricsSnapshot{
+		status:    p.status(),
+		lastSweep: math.NaN(),
+	}
+
+	if head := p.hm.Head(); head != nil {
+		snapshot.lastSweep = float64(head.DateTime.UnixNano()) / 1e9
+	}
+
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+
+	snapshot.bands = maps.Clone(p.stats.bands)
+
+	return snapshot
+}
+
+// metricsHandler exposes the counters of the pipelines and the measurements
+// of their bands to Prometheus.
+func metricsHandler(pipelines []*pipeline) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshots := make([]metricsSnapshot, len(pipelines))
+		for i, p := range pipelines {
+			snapshots[i] = p.metrics()
+		}
+
+		e := &exposition{}
+
+		metric := func(name, kind, help string, value func(s metricsSnapshot) float64) {
+			e.family(name, kind, help)
+			for _, s := range snapshots {
+				e.sample(name, value(s), "stream", s.Stream)
+			}
+		}
+
+		metric("numa_input_running", "gauge", "Whether the input of the stream is open.", func(s metricsSnapshot) float64 {
+			if s.Running {
+				return 1
+			}
+			return 0
+		})
+		metric("numa_lines_total", "counter", "Lines read from the input.", func(s metricsSnapshot) float64 {
+			return float64(s.Lines)
+		})
+
+		e.family("numa_errors_total", "counter", "Lines that could not be parsed or added to a sweep, by kind.")
+		for _, s := range snapshots {
+			for _, kind := range slices.Sorted(maps.Keys(s.Errors)) {
+				e.sample("numa_errors_total", float64(s.Errors[kind]), "stream", s.Stream, "kind", kind)
+			}
+		}
+
+		metric("numa_sweeps_total", "counter", "Sweeps completed.", func(s metricsSnapshot) float64 {
+			return float64(s.Sweeps)
+		})
+		metric("numa_sweep_rate", "gauge", "Sweeps per second over the recent sweeps.", func(s metricsSnapshot) float64 {
+			return s.SweepRate
+		})
+		metric("numa_last_sweep_timestamp_seconds", "gauge", "Time of the last sweep, as recorded by rtl_power.", func(s metricsSnapshot) float64 {
+			return s.lastSweep
+		})
+		metric("numa_clients", "gauge", "Clients connected to the event streams of the stream.", func(s metricsSnapshot) float64 {
+			return float64(s.Clients)
+		})
+		metric("numa_dropped_events_total", "counter", "Events dropped for clients that fell behind.", func(s metricsSnapshot) float64 {
+			return float64(s.DroppedEvents)
+		})
+		metric("numa_history_sweeps", "gauge", "Sweeps held by the history.", func(s metricsSnapshot) float64 {
+			return float64(s.HistorySweeps)
+		})
+		metric("numa_history_bytes", "gauge", "Approximate memory held by the history.", func(s metricsSnapshot) float64 {
+			return float64(s.HistoryBytes)
+		})
+
+		bandGauge := func(name, help string, value func(m band.Measurement) float64) {
+			e.family(name, "gauge", help)
+			for i, s := range snapshots {
+				for _, b := range pipelines[i].bands {
+					if m, ok := s.bands[b.Name]; ok {
+						e.sample(name, value(m), "stream", s.Stream, "band", b.Name)
+					}
+				}
+			}
+		}
+
+		bandGauge("numa_band_power_db", "Integrated power of the band in the last sweep.", func(m band.Measurement) float64 {
+			return float64(m.Power)
+		})
+		bandGauge("numa_band_peak_power_db", "Power of the strongest bin of the band in the last sweep.", func(m band.Measurement) float64 {
+			return float64(m.PeakPower)
+		})
+		bandGauge("numa_band_peak_frequency_hz", "Centre frequency of the strongest bin of the band in the last sweep.", func(m band.Measurement) float64 {
+			return float64(m.PeakFrequency)
+		})
+
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", e.Bytes())
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power/floor"
+	"github.com/olistrik/numa-sdr/api/sdr/power/occupancy"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// queryDecabel reads a dB query parameter, reporting whether it was given.
+func queryDecabel(c *gin.Context, name string) (unit.Decabel, bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, false, nil
+	}
+
+	db, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return unit.Decabel(db), true, nil
+}
+
+// queryPercentile reads a percentile query parameter between 0 and 1.
+func queryPercentile(c *gin.Context, name string, fallback float64) (float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	percentile, err := strconv.ParseFloat(value, 64)
+	if err != nil || percentile < 0 || percentile > 1 {
+		return 0, fmt.Errorf("invalid %s %q, expected between 0 and 1", name, value)
+	}
+
+	return percentile, nil
+}
+
+// queryRule returns the occupancy rule of the query: the absolute
+// `threshold`, `above_floor` dB above the floor of each bin over
+// `floor_window`, or by default `above_noise` dB above the
+// `noise_percentile` of each sweep.
+func queryRule(c *gin.Context) (occupancy.Rule, error) {
+	threshold, ok, err := queryDecabel(c, "threshold")
+	if err != nil || ok {
+		return occupancy.Threshold(threshold), err
+	}
+
+	margin, ok, err := queryDecabel(c, "above_floor")
+	if err != nil {
+		return occupancy.Rule{}, err
+	}
+
+	if ok {
+		window, err := queryDuration(c, "floor_window", 10*time.Minute)
+		if err != nil {
+			return occupancy.Rule{}, err
+		}
+
+		percentile, err := queryPercentile(c, "floor_percentile", 0.5)
+		if err != nil {
+			return occupancy.Rule{}, err
+		}
+
+		return occupancy.AboveFloor(margin, floor.Window(window), floor.Percentile(percentile)), nil
+	}
+
+	margin, ok, err = queryDecabel(c, "above_noise")
+	if err != nil {
+		return occupancy.Rule{}, err
+	}
+	if !ok {
+		margin = 10
+	}
+
+	percentile, err := queryPercentile(c, "noise_percentile", 0.1)
+	if err != nil {
+		return occupancy.Rule{}, err
+	}
+
+	return occupancy.AboveNoise(margin, percentile), nil
+}
+
+// occupancy measures the occupancy of the sweeps selected by the query, in
+// its view and frequency range, by the rule of the query. The bands of the
+// pipeline are summarised and the heatmap has a row per `interval`.
+func (p *pipeline) occupancy(c *gin.Context) (*occupancy.Calculator, error) {
+	interval, err := queryDuration(c, "interval", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := queryRule(c)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []occupancy.Option{
+		occupancy.Interval(interval),
+		occupancy.Bands(p.bands...),
+		occupancy.Occupied(rule),
+	}
+
+	scans, err := p.scans(c)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := frequencyRange(c)
+	if err != nil {
+		return nil, err
+	}
+
+	calculator := occupancy.New(opts...)
+	for _, scan := range sinceLayout(scans) {
+		if end > start {
+			scan = scan.Slice(start, end)
+		}
+		calculator.Add(scan)
+	}
+
+	return calculator, nil
+}
+
+// nullable returns the value, or nil for NaN, which JSON cannot hold.
+func nullable(value float64) *float64 {
+	if math.IsNaN(value) {
+		return nil
+	}
+
+	return &value
+}
+
+// bandOccupancyInfo is the occupancy of a band, with null for bands without
+// values.
+type bandOccupancyInfo struct {
+	Name      string         `json:"name"`
+	Start     unit.Frequency `json:"start"`
+	End       unit.Frequency `json:"end"`
+	DutyCycle *float64       `json:"duty_cycle"`
+	Busy      *float64       `json:"busy"`
+	Bins      int            `json:"bins"`
+}
+
+// occupancyInfo is the occupancy of a window of the history, with the duty
+// cycle of each bin as a percentage, null for bins without values.
+type occupancyInfo struct {
+	Start       time.Time           `json:"start"`
+	End         time.Time           `json:"end"`
+	Sweeps      int                 `json:"sweeps"`
+	Threshold   unit.Decabel        `json:"threshold"`
+	Relative    bool                `json:"relative"`
+	Frequencies []unit.Frequency    `json:"frequencies"`
+	DutyCycle   []*float64          `json:"duty_cycle"`
+	Bands       []bandOccupancyInfo `json:"bands"`
+}
+
+// occupancyHandler serves the duty cycle of each bin and band.
+func (p *pipeline) occupancyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		calculator, err := p.occupancy(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		info := occupancyInfo{
+			Start:       calculator.Start,
+			End:         calculator.End,
+			Sweeps:      calculator.Sweeps,
+			Threshold:   calculator.Rule.Level,
+			Relative:    calculator.Rule.Relative(),
+			Frequencies: calculator.Frequencies(),
+			DutyCycle:   []*float64{},
+			Bands:       []bandOccupancyInfo{},
+		}
+
+		for _, duty := range calculator.DutyCycle() {
+			info.DutyCycle = append(info.DutyCycle, nullable(duty))
+		}
+
+		for _, b := range calculator.Bands() {
+			info.Bands = append(info.Bands, bandOccupancyInfo{
+				Name:      b.Name,
+				Start:     b.Start,
+				End:       b.End,
+				DutyCycle: nullable(b.DutyCycle),
+				Busy:      nullable(b.Busy),
+				Bins:      b.Bins,
+			})
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// occupancyCSVHandler serves the duty cycle of each bin as CSV, or of each
+// band with `?bands`.
+func (p *pipeline) occupancyCSVHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bands, err := queryBool(c, "bands")
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid bands: %v", err)
+			return
+		}
+
+		calculator, err := p.occupancy(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		filename, write := "occupancy.csv", calculator.WriteCSV
+		if bands {
+			filename, write = "occupancy.bands.csv", calculator.WriteBandsCSV
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		if err := write(c.Writer); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// occupancyHeatmapHandler renders the occupancy of each interval as a PNG
+// heatmap, from 0 to 100% unless `min` and `max` are given.
+func (p *pipeline) occupancyHeatmapHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		calculator, err := p.occupancy(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err := waterfallOptions(c, maxImagePixels)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts = append([]render.Option{render.Levels(0, 100)}, opts...)
+		img := render.NewWaterfall(opts...).Render(calculator.Heatmap())
+
+		c.Header("Content-Type", "image/png")
+		c.Header("Cache-Control", "no-cache")
+		if err := png.Encode(c.Writer, img); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
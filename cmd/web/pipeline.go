@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/alert"
+	"github.com/olistrik/numa-sdr/api/annotation"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/auth"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/sse"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/ws"
+	"github.com/olistrik/numa-sdr/api/export"
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	"github.com/olistrik/numa-sdr/api/sdr/power/detect"
+	"github.com/olistrik/numa-sdr/api/sdr/power/floor"
+	power_history "github.com/olistrik/numa-sdr/api/sdr/power/history"
+	"github.com/olistrik/numa-sdr/api/sdr/power/profile"
+	"github.com/olistrik/numa-sdr/api/sdr/power/reference"
+	"github.com/olistrik/numa-sdr/api/sdr/power/track"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamName limits stream names to what can be used in a path unescaped.
+var streamName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// streamSpec describes a stream given with --stream as
+// `name=input[;offset=float][;history=duration][;title=string]`, where input
+// is a file or FIFO, - for stdin, or `exec:command` to run a command.
+type streamSpec struct {
+	Name    string
+	Input   string
+	Title   string
+	Offset  unit.Frequency
+	History time.Duration
+}
+
+func parseStreamSpec(value string) (streamSpec, error) {
+	spec := streamSpec{
+		Offset:  args.Offset,
+		History: args.History,
+	}
+
+	name, rest, ok := strings.Cut(value, "=")
+	if !ok || !streamName.MatchString(name) {
+		return spec, fmt.Errorf("invalid stream %q, expected name=input with a name of letters, digits, _ and -", value)
+	}
+
+	options := strings.Split(rest, ";")
+
+	spec.Name = name
+	spec.Title = name
+	spec.Input = options[0]
+
+	if spec.Input == "" {
+		return spec, fmt.Errorf("stream %s has no input", name)
+	}
+
+	for _, option := range options[1:] {
+		key, value, _ := strings.Cut(option, "=")
+
+		var err error
+		switch key {
+		case "offset":
+			err = spec.Offset.UnmarshalText([]byte(value))
+		case "history":
+			spec.History, err = time.ParseDuration(value)
+		case "title":
+			spec.Title = value
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+
+		if err != nil {
+			return spec, fmt.Errorf("stream %s: %w", name, err)
+		}
+	}
+
+	return spec, nil
+}
+
+// pipeline is a stream of sweeps read from one input, with its own history,
+// broker and tiles.
+type pipeline struct {
+	streamSpec
+
+	hm     *power_history.History
+	stream *broker.Broker
+	tiles  *tileCache
+	stats  *pipelineStats
+
+	// pyramid pools the sweeps of the history for every zoom level of the
+	// tiles.
+	pyramid *render.Pyramid
+
+	// bands are measured in every sweep.
+	bands []band.Band
+
+	annotations *annotation.Store
+
+	// alerts evaluates the alert rules against every sweep, when there are
+	// any.
+	alerts *alert.Engine
+
+	// detector finds signals in every sweep, when enabled.
+	detector   *detect.Detector
+	detections *detectionLog
+
+	// tracker links the detections into emissions, logging them to
+	// activity.
+	tracker  *track.Tracker
+	activity *track.Log
+
+	// floor estimates the noise floor of every bin, when enabled, with snr
+	// broadcasting the sweeps relative to it.
+	floor *floor.Estimator
+	snr   *broker.Broker
+
+	// references are the saved reference spectra. The selected reference
+	// is subtracted from the sweeps of difference.
+	references *reference.Library
+	reference  atomic.Pointer[reference.Reference]
+	difference *broker.Broker
+
+	// bandPower broadcasts the power of the bands in every sweep, when there
+	// are any.
+	bandPower *broker.Broker
+
+	// profiles fold every sweep onto a day and a week, when enabled.
+	profiles map[profile.Period]*profileStore
+}
+
+// dataFile returns the path of a file in the stream's directory of the data
+// directory, creating the directory. It is empty without a data directory.
+func dataFile(dataDir, stream, name string) (string, error) {
+	if dataDir == "" {
+		return "", nil
+	}
+
+	dir := filepath.Join(dataDir, stream)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// newPipeline creates the pipeline of a stream. Its annotations are kept in
+// the stream's directory of the data directory, when there is one.
+func newPipeline(spec streamSpec, bands []band.Band, dataDir string) (*pipeline, error) {
+	file, err := dataFile(dataDir, spec.Name, "annotations.json")
+	if err != nil {
+		return nil, err
+	}
+
+	annotations, err := annotation.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	references, err := reference.Open(referencesDir(dataDir, spec.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pipeline{
+		streamSpec:  spec,
+		bands:       bands,
+		annotations: annotations,
+		references:  references,
+		detections:  &detectionLog{retention: spec.History},
+		hm: power_history.New(
+			power_history.MaxDuration(spec.History),
+		),
+		tiles:   newTileCache(args.TileCache),
+		pyramid: &render.Pyramid{},
+		stats:   newPipelineStats(),
+	}
+
+	p.stream = p.broker(nil)
+	p.difference = p.broker(p.subtract)
+
+	if len(bands) > 0 {
+		p.bandPower = p.bandPowerBroker()
+	}
+
+	return p, nil
+}
+
+// broker returns a broker for the sweeps of the pipeline, each passed through
+// view when it is not nil. Sweeps the view returns nil for are left out.
+func (p *pipeline) broker(view func(*power.Scan) *power.Scan) *broker.Broker {
+	if view == nil {
+		view = func(scan *power.Scan) *power.Scan { return scan }
+	}
+
+	return broker.New(
+		broker.OnConnect(func(client *broker.Client) {
+			// the annotations follow the sweeps, as part of the initial
+			// state.
+			defer client.SendEvent(broker.Event{Name: "annotations", Value: p.annotations.List()})
+
+			// a reconnecting client only needs the sweeps it missed.
+			if id := client.LastEventID(); id != 0 {
+				if scans, ok := p.hm.Since(id); ok {
+					for i, scan := range scans {
+						if scan = view(scan); scan != nil {
+							client.SendEvent(broker.Event{ID: id + uint64(i) + 1, Name: "scan", Value: scan})
+						}
+					}
+					return
+				}
+			}
+
+			scans, id := p.hm.Snapshot()
+
+			viewed := make([]*power.Scan, 0, len(scans))
+			for _, scan := range scans {
+				if scan = view(scan); scan != nil {
+					viewed = append(viewed, scan)
+				}
+			}
+
+			client.SendEvent(broker.Event{ID: id, Name: "init", Value: viewed})
+		}),
+		broker.Encoding("quantized", func(value any) ([]byte, error) {
+			return json.Marshal(quantize(value))
+		}),
+	)
+}
+
+// brokers returns every broker of the pipeline, for the events that are not
+// about a single view of the sweeps.
+func (p *pipeline) brokers() []*broker.Broker {
+	brokers := []*broker.Broker{p.stream, p.difference}
+	if p.snr != nil {
+		brokers = append(brokers, p.snr)
+	}
+	if p.bandPower != nil {
+		brokers = append(brokers, p.bandPower)
+	}
+
+	return brokers
+}
+
+// push adds a scan to the history, broadcasting the sweeps it completes.
+func (p *pipeline) push(scan *power.Scan) error {
+	before := p.hm.Sweeps()
+
+	complete, err := p.hm.Push(scan)
+	if err != nil {
+		return err
+	}
+
+	if complete {
+		sweeps := p.hm.Completed(before)
+		first := p.hm.Sweeps() - uint64(len(sweeps)) + 1
+
+		for i, sweep := range sweeps {
+			samples := p.measureBands(sweep)
+
+			p.stats.sweep(samples)
+			p.pyramid.Add(sweep)
+			p.pyramid.Trim(p.hm.Tail().DateTime)
+			p.tiles.update(sweep)
+			if p.alerts != nil {
+				p.alerts.Evaluate(p.Name, sweep)
+			}
+			p.detect(sweep)
+			p.stream.SendEvent(broker.Event{ID: first + uint64(i), Name: "scan", Value: sweep})
+			p.updateFloor(first+uint64(i), sweep)
+			p.updateProfiles(sweep)
+			p.sendBandPower(first+uint64(i), samples)
+			p.difference.SendEvent(broker.Event{ID: first + uint64(i), Name: "scan", Value: p.subtract(sweep)})
+		}
+	}
+
+	return nil
+}
+
+// run reads the input until it is exhausted. Lines read from stdin are
+// forwarded to stdout, so that numa_web can sit in the middle of a pipe.
+func (p *pipeline) run() {
+	var input io.Reader
+	var forward io.Writer
+
+	switch {
+	case p.Input == "-":
+		input, forward = os.Stdin, os.Stdout
+
+	case strings.HasPrefix(p.Input, "exec:"):
+		stderr := log.WithField("stream", p.Name).WriterLevel(log.WarnLevel)
+		defer stderr.Close()
+
+		cmd := exec.Command("sh", "-c", strings.TrimPrefix(p.Input, "exec:"))
+		cmd.Stderr = stderr
+
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			log.Errorf("stream %s: %v", p.Name, err)
+			return
+		}
+
+		if err := cmd.Start(); err != nil {
+			log.Errorf("stream %s: %v", p.Name, err)
+			return
+		}
+
+		defer func() {
+			if err := cmd.Wait(); err != nil {
+				log.Errorf("stream %s: %v", p.Name, err)
+			}
+		}()
+
+		input = stdout
+
+	default:
+		file, err := os.Open(p.Input)
+		if err != nil {
+			log.Errorf("stream %s: %v", p.Name, err)
+			return
+		}
+		defer file.Close()
+
+		input = file
+	}
+
+	p.stats.running.Store(true)
+	p.process(input, forward)
+	p.stats.running.Store(false)
+
+	log.Infof("stream %s: input ended", p.Name)
+}
+
+// alertsHandler lists the alert rules that are firing on the stream.
+func (p *pipeline) alertsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		firing := []alert.Notification{}
+		if p.alerts != nil {
+			firing = slices.DeleteFunc(p.alerts.Firing(), func(n alert.Notification) bool {
+				return n.Stream != p.Name
+			})
+		}
+
+		c.JSON(http.StatusOK, firing)
+	}
+}
+
+// broadcastStatus sends a status event to the clients every interval, or
+// never when it is 0.
+func (p *pipeline) broadcastStatus(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	for range time.Tick(interval) {
+		p.stream.SendEvent(broker.Event{Name: "status", Value: p.status()})
+	}
+}
+
+// page serves the monitor page of the stream.
+func (p *pipeline) page(r gin.IRoutes) {
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index.html.tmpl", gin.H{
+			"title": p.Title,
+		})
+	})
+}
+
+// adminOnly rejects the requests of principals below admin, for the control
+// endpoints among the routes that viewers are served.
+func adminOnly(c *gin.Context) {
+	if principal, ok := auth.FromContext(c); !ok || principal.Role < auth.Admin {
+		c.String(http.StatusForbidden, "only admins may use this endpoint")
+		c.Abort()
+	}
+}
+
+// routes serves the streams, renders and exports of the pipeline.
+func (p *pipeline) routes(r gin.IRoutes, station export.Station) {
+	hm := p.hm
+
+	r.GET("/stream/scans", sse.Handler(p.stream))
+	r.GET("/stream/ws", ws.Handler(p.stream))
+	r.PUT("/stream/clients/:id/subscription", p.stream.SubscriptionHandler())
+
+	if p.snr != nil {
+		r.GET("/stream/snr", sse.Handler(p.snr))
+		r.GET("/stream/snr/ws", ws.Handler(p.snr))
+		r.PUT("/stream/snr/clients/:id/subscription", p.snr.SubscriptionHandler())
+	}
+
+	r.GET("/stream/difference", sse.Handler(p.difference))
+	r.GET("/stream/difference/ws", ws.Handler(p.difference))
+	r.PUT("/stream/difference/clients/:id/subscription", p.difference.SubscriptionHandler())
+
+	if p.bandPower != nil {
+		r.GET("/stream/bands", sse.Handler(p.bandPower))
+		r.GET("/stream/bands/ws", ws.Handler(p.bandPower))
+		r.PUT("/stream/bands/clients/:id/subscription", p.bandPower.SubscriptionHandler())
+	}
+
+	r.GET("/render/waterfall.png", p.waterfallHandler())
+	r.GET("/render/waterfall.mjpeg", p.mjpegHandler())
+	r.GET("/render/timelapse.gif", p.timelapseHandler())
+	r.GET("/render/occupancy.png", p.occupancyHeatmapHandler())
+	r.GET("/render/profile.png", p.profileHeatmapHandler())
+	r.GET("/export/scans.csv", p.csvHandler())
+	r.GET("/export/waterfall.npz", p.exportHandler("waterfall.npz", "application/zip", (*export.Matrix).WriteNpz))
+	r.GET("/export/waterfall.npy", p.npyHandler())
+	r.GET("/export/statistics.csv", p.statisticsCSVHandler())
+	r.GET("/export/occupancy.csv", p.occupancyCSVHandler())
+	r.GET("/export/band-power.csv", p.bandPowerCSVHandler())
+	r.GET("/export/profile.npz", p.profileExportHandler("npz"))
+	r.GET("/export/profile.csv", p.profileExportHandler("csv"))
+	r.GET("/export/waterfall.fits", p.exportHandler("waterfall.fits", "application/fits", func(m *export.Matrix, w io.Writer) error {
+		return m.WriteFITS(w, station)
+	}))
+
+	r.GET("/api/status", p.statusHandler())
+	r.GET("/api/annotations", p.annotationsHandler())
+	r.POST("/api/annotations", p.createAnnotationHandler())
+	r.DELETE("/api/annotations/:id", p.deleteAnnotationHandler())
+	r.GET("/api/alerts", p.alertsHandler())
+	r.GET("/api/floor", p.floorHandler())
+	r.GET("/api/statistics", p.statisticsHandler())
+	r.GET("/api/occupancy", p.occupancyHandler())
+	r.GET("/api/profile", p.profileHandler())
+	r.GET("/api/band-power", p.bandPowerHandler())
+	r.GET("/api/references", p.referencesHandler())
+	r.POST("/api/references", adminOnly, p.captureReferenceHandler())
+	r.GET("/api/references/:name", p.referenceHandler())
+	r.DELETE("/api/references/:name", adminOnly, p.deleteReferenceHandler())
+	r.GET("/api/reference", p.selectedReferenceHandler())
+	r.PUT("/api/reference", adminOnly, p.selectReferenceHandler())
+	r.GET("/api/detections", p.detectionsHandler())
+	r.GET("/api/activity", p.activityHandler())
+	r.GET("/api/activity/active", p.activeHandler())
+	r.GET("/export/activity.csv", p.activityCSVHandler())
+
+	r.GET("/tiles.json", tileInfoHandler(hm))
+	r.GET("/tiles/:zoom/:x/:y", tileHandler(hm, p.pyramid, p.tiles))
+}
+
+// streamInfo describes a pipeline in the stream listing.
+type streamInfo struct {
+	Name           string          `json:"name"`
+	Title          string          `json:"title"`
+	Path           string          `json:"path"`
+	Offset         unit.Frequency  `json:"offset"`
+	History        string          `json:"history"`
+	Sweeps         uint64          `json:"sweeps"`
+	Clients        int             `json:"clients"`
+	StartFrequency *unit.Frequency `json:"start_frequency,omitempty"`
+	EndFrequency   *unit.Frequency `json:"end_frequency,omitempty"`
+	LastSweep      *time.Time      `json:"last_sweep,omitempty"`
+}
+
+func (p *pipeline) info() streamInfo {
+	info := streamInfo{
+		Name:    p.Name,
+		Title:   p.Title,
+		Path:    "/streams/" + p.Name + "/",
+		Offset:  p.Offset,
+		History: p.History.String(),
+		Sweeps:  p.hm.Sweeps(),
+		Clients: p.clients(),
+	}
+
+	if head := p.hm.Head(); head != nil {
+		info.StartFrequency = &head.StartFrequency
+		info.EndFrequency = &head.EndFrequency
+		info.LastSweep = &head.DateTime
+	}
+
+	return info
+}
+
+// streamsHandler lists the streams as JSON.
+func streamsHandler(pipelines []*pipeline) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streams := make([]streamInfo, len(pipelines))
+		for i, p := range pipelines {
+			streams[i] = p.info()
+		}
+
+		c.JSON(http.StatusOK, streams)
+	}
+}
+
+// streamsPageHandler serves the index page of the streams.
+func streamsPageHandler(pipelines []*pipeline) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streams := make([]streamInfo, len(pipelines))
+		for i, p := range pipelines {
+			streams[i] = p.info()
+		}
+
+		c.HTML(http.StatusOK, "streams.html.tmpl", gin.H{
+			"title":   args.Title,
+			"streams": streams,
+		})
+	}
+}
+
+// process reads rtl_power lines from r, forwarding them to forward when it
+// is not nil, and pushes each scan. Lines are read as the CLI reads them, so
+// that wide sweeps fit.
+func (p *pipeline) process(r io.Reader, forward io.Writer) {
+	reader := power.NewReader(r)
+	reader.Offset = p.Offset
+
+	for {
+		scan, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+
+		var parseErr *power.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			log.Errorln(err)
+			return
+		}
+
+		p.stats.lines.Add(1)
+
+		// forward line
+		if forward != nil {
+			fmt.Fprintln(forward, reader.Line())
+		}
+
+		if err != nil {
+			p.stats.error(err)
+			log.Errorln(err)
+			continue
+		}
+
+		if err := p.push(scan); err != nil {
+			p.stats.error(err)
+			log.Errorln(err)
+			continue
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/profile"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// profileSaveInterval is how often, in the time of the sweeps, the profiles
+// are saved.
+const profileSaveInterval = 5 * time.Minute
+
+// profileStore is a profile of every sweep of a stream, saved to its file in
+// the data directory every profileSaveInterval.
+type profileStore struct {
+	mu      sync.RWMutex
+	profile *profile.Profile
+	file    string
+	saved   time.Time
+}
+
+// foldProfiles folds every sweep of the stream onto daily and weekly profiles,
+// each with the options and the slot of its period. They are restored from
+// the stream's directory of the data directory, when there is one.
+func (p *pipeline) foldProfiles(dataDir string, slots map[profile.Period]time.Duration, opts ...profile.Option) error {
+	p.profiles = map[profile.Period]*profileStore{}
+
+	for _, period := range []profile.Period{profile.Daily, profile.Weekly} {
+		pr, err := profile.New(period, append(opts, profile.Slot(slots[period]))...)
+		if err != nil {
+			return err
+		}
+
+		file, err := dataFile(dataDir, p.Name, "profile."+string(period)+".json")
+		if err != nil {
+			return err
+		}
+
+		if file != "" {
+			if err := pr.Load(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+
+		p.profiles[period] = &profileStore{profile: pr, file: file}
+	}
+
+	return nil
+}
+
+// updateProfiles adds a completed sweep to the profiles, starting them afresh
+// when the sweeps change frequency range or number of bins.
+func (p *pipeline) updateProfiles(sweep *power.Scan) {
+	for _, store := range p.profiles {
+		store.mu.Lock()
+
+		if !store.profile.Add(sweep) {
+			log.Warnf("stream %s: the sweeps changed frequencies, restarting the %s profile", p.Name, store.profile.Period)
+			store.profile.Reset()
+			store.profile.Add(sweep)
+		}
+
+		if store.file != "" && sweep.DateTime.Sub(store.saved).Abs() >= profileSaveInterval {
+			if err := store.profile.Save(store.file); err != nil {
+				log.Errorf("stream %s: %v", p.Name, err)
+			}
+			store.saved = sweep.DateTime
+		}
+
+		store.mu.Unlock()
+	}
+}
+
+// queryProfile returns the profile of the `period` query parameter, daily by
+// default.
+func (p *pipeline) queryProfile(c *gin.Context) (*profileStore, error) {
+	if p.profiles == nil {
+		return nil, fmt.Errorf("profiles are not enabled, see --profiles")
+	}
+
+	period := profile.Daily
+	if value := c.Query("period"); value != "" {
+		if err := period.UnmarshalText([]byte(value)); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.profiles[period], nil
+}
+
+// profileMatrix returns the `matrix` query parameter's matrix of the profile,
+// mean by default. It must be called with the profile locked.
+func profileMatrix(c *gin.Context, pr *profile.Profile) (string, [][]float64, error) {
+	switch name := c.DefaultQuery("matrix", "mean"); name {
+	case "mean":
+		return name, pr.Mean(), nil
+	case "occupancy":
+		return name, pr.Occupancy(), nil
+	default:
+		return name, nil, fmt.Errorf("unknown matrix %q, expected mean or occupancy", name)
+	}
+}
+
+// profileInfo is a profile of a stream, with a row per slot and a column per
+// bin, and null where a slot had no sweeps.
+type profileInfo struct {
+	Period      profile.Period   `json:"period"`
+	Slot        string           `json:"slot"`
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	Sweeps      int              `json:"sweeps"`
+	Threshold   unit.Decabel     `json:"threshold"`
+	Slots       []string         `json:"slots"`
+	SlotSweeps  []int            `json:"slot_sweeps"`
+	Frequencies []unit.Frequency `json:"frequencies"`
+	Mean        [][]*float64     `json:"mean"`
+	Occupancy   [][]*float64     `json:"occupancy"`
+}
+
+// nullableMatrix returns the matrix with null for NaN, rounded to 0.01.
+func nullableMatrix(matrix [][]float64) [][]*float64 {
+	rows := make([][]*float64, len(matrix))
+	for i, values := range matrix {
+		rows[i] = make([]*float64, len(values))
+		for j, value := range values {
+			rows[i][j] = nullable(math.Round(value*100) / 100)
+		}
+	}
+
+	return rows
+}
+
+// profileHandler serves the mean power and occupancy of each bin in each
+// slot of the `period`.
+func (p *pipeline) profileHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store, err := p.queryProfile(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		store.mu.RLock()
+		pr := store.profile
+		info := profileInfo{
+			Period:      pr.Period,
+			Slot:        pr.Slot.String(),
+			Start:       pr.Start,
+			End:         pr.End,
+			Sweeps:      pr.Sweeps,
+			Threshold:   pr.Rule.Level,
+			Slots:       pr.Labels(),
+			SlotSweeps:  pr.RowSweeps(),
+			Frequencies: pr.Frequencies(),
+			Mean:        nullableMatrix(pr.Mean()),
+			Occupancy:   nullableMatrix(pr.Occupancy()),
+		}
+		store.mu.RUnlock()
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// profileExportHandler serves the profile of the `period` as a .npz archive,
+// or the `matrix` as CSV. The file is written to a buffer, so that the
+// profile is not locked while it is sent.
+func (p *pipeline) profileExportHandler(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store, err := p.queryProfile(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var buf bytes.Buffer
+		filename, contentType := fmt.Sprintf("profile.%s.npz", store.profile.Period), "application/zip"
+
+		store.mu.RLock()
+		if format == "csv" {
+			var name string
+			var matrix [][]float64
+			if name, matrix, err = profileMatrix(c, store.profile); err == nil {
+				filename, contentType = fmt.Sprintf("profile.%s.%s.csv", store.profile.Period, name), "text/csv"
+				err = store.profile.WriteCSV(&buf, matrix)
+			}
+		} else {
+			err = store.profile.WriteNpz(&buf)
+		}
+		store.mu.RUnlock()
+
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+// profileHeatmapHandler renders the `matrix` of the profile of the `period`
+// as a PNG heatmap, the occupancy from 0 to 100% unless `min` and `max` are
+// given.
+func (p *pipeline) profileHeatmapHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store, err := p.queryProfile(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err := waterfallOptions(c, maxImagePixels)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		store.mu.RLock()
+		name, matrix, err := profileMatrix(c, store.profile)
+		scans, layout := store.profile.Heatmap(matrix)
+		store.mu.RUnlock()
+
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if name == "occupancy" {
+			opts = append([]render.Option{render.Levels(0, 100)}, opts...)
+		}
+
+		img := render.NewWaterfall(append(opts, render.TimeFormat(layout))...).Render(scans)
+
+		c.Header("Content-Type", "image/png")
+		c.Header("Cache-Control", "no-cache")
+		if err := png.Encode(c.Writer, img); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
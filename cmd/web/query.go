@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	power_history "github.com/olistrik/numa-sdr/api/sdr/power/history"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+const (
+	// maxImageSize limits the width and height of rendered images, and
+	// maxImagePixels their area.
+	maxImageSize   = 8192
+	maxImagePixels = 4 << 20
+
+	// maxStreamPixels limits the area of the frames of an MJPEG stream, which
+	// are rendered again for every sweep.
+	maxStreamPixels = 1 << 20
+)
+
+// timeWindow reads the `from` and `to` query parameters, or `last` as a
+// duration before the newest sweep. Missing ends are left zero.
+func timeWindow(c *gin.Context, hm *power_history.History) (time.Time, time.Time, error) {
+	var from, to time.Time
+
+	if value := c.Query("last"); value != "" {
+		last, err := time.ParseDuration(value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid last: %w", err)
+		}
+
+		if head := hm.Head(); head != nil {
+			from = head.DateTime.Add(-last)
+		}
+	}
+
+	if value := c.Query("from"); value != "" {
+		t, err := power.ParseTime(value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+
+	if value := c.Query("to"); value != "" {
+		t, err := power.ParseTime(value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+
+	return from, to, nil
+}
+
+// window returns the sweeps of the history selected by timeWindow.
+func window(c *gin.Context, hm *power_history.History) ([]*power.Scan, error) {
+	from, to, err := timeWindow(c, hm)
+	if err != nil {
+		return nil, err
+	}
+
+	return hm.Window(from, to), nil
+}
+
+// view returns how the sweeps are given by the `view` query parameter: as
+// recorded, `power` (the default), relative to the current noise floor,
+// `snr`, or less a reference, `difference`. It is nil for power.
+func (p *pipeline) view(c *gin.Context) (func(*power.Scan) *power.Scan, error) {
+	switch view := c.DefaultQuery("view", "power"); view {
+	case "power":
+		return nil, nil
+	case "snr":
+		if p.floor == nil {
+			return nil, errors.New("the noise floor is not enabled, see --floor-window")
+		}
+		return p.floor.SNR, nil
+	case "difference":
+		r, err := p.queryReference(c)
+		if err != nil {
+			return nil, err
+		}
+		return r.Difference, nil
+	default:
+		return nil, fmt.Errorf("unknown view %q, expected power, snr or difference", view)
+	}
+}
+
+// scans returns the window of the history selected by the query, in its
+// view.
+func (p *pipeline) scans(c *gin.Context) ([]*power.Scan, error) {
+	view, err := p.view(c)
+	if err != nil {
+		return nil, err
+	}
+
+	scans, err := window(c, p.hm)
+	if err != nil {
+		return nil, err
+	}
+
+	if view != nil {
+		for i, scan := range scans {
+			scans[i] = view(scan)
+		}
+	}
+
+	return scans, nil
+}
+
+// sinceLayout returns the scans since the frequencies or number of bins last
+// changed, those with the layout of the newest.
+func sinceLayout(scans []*power.Scan) []*power.Scan {
+	first := len(scans)
+	for first > 0 && scans[first-1].SameLayout(scans[len(scans)-1]) {
+		first--
+	}
+
+	return scans[first:]
+}
+
+// frequencyRange reads the `start` and `end` query parameters. Missing ends
+// are left zero.
+func frequencyRange(c *gin.Context) (unit.Frequency, unit.Frequency, error) {
+	var start, end unit.Frequency
+
+	if value := c.Query("start"); value != "" {
+		if err := start.UnmarshalText([]byte(value)); err != nil {
+			return start, end, fmt.Errorf("invalid start: %w", err)
+		}
+	}
+
+	if value := c.Query("end"); value != "" {
+		if err := end.UnmarshalText([]byte(value)); err != nil {
+			return start, end, fmt.Errorf("invalid end: %w", err)
+		}
+	}
+
+	return start, end, nil
+}
+
+// queryInt reads an integer query parameter between 1 and max.
+func queryInt(c *gin.Context, name string, fallback, max int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, max)
+	}
+
+	return n, nil
+}
+
+// queryDuration reads a positive duration query parameter.
+func queryDuration(c *gin.Context, name string, fallback time.Duration) (time.Duration, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration", name)
+	}
+
+	return d, nil
+}
+
+// queryBool reads a boolean query parameter, where a bare `?name` is true.
+func queryBool(c *gin.Context, name string) (bool, error) {
+	value, ok := c.GetQuery(name)
+	if !ok {
+		return false, nil
+	}
+
+	if value == "" {
+		return true, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+// waterfallOptions reads the `width`, `height`, `colormap`, `min`, `max`,
+// `axes`, `start` and `end` query parameters. The image may cover at most
+// pixels.
+func waterfallOptions(c *gin.Context, pixels int) ([]render.Option, error) {
+	width, err := queryInt(c, "width", 800, maxImageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	height, err := queryInt(c, "height", 600, maxImageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if width*height > pixels {
+		return nil, fmt.Errorf("the image is too large, width times height must be at most %d pixels", pixels)
+	}
+
+	opts := []render.Option{render.Size(width, height)}
+
+	if name := c.Query("colormap"); name != "" {
+		cm, ok := render.ColormapByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown colormap %q, expected one of %v", name, render.ColormapNames())
+		}
+		opts = append(opts, render.WithColormap(cm))
+	}
+
+	minValue, hasMin := c.GetQuery("min")
+	maxValue, hasMax := c.GetQuery("max")
+	if hasMin != hasMax {
+		return nil, fmt.Errorf("min and max must be given together")
+	}
+
+	if hasMin {
+		lo, err := strconv.ParseFloat(minValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min: %w", err)
+		}
+
+		hi, err := strconv.ParseFloat(maxValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max: %w", err)
+		}
+
+		if hi <= lo {
+			return nil, fmt.Errorf("max must be above min")
+		}
+
+		opts = append(opts, render.Levels(unit.Decabel(lo), unit.Decabel(hi)))
+	}
+
+	axes, err := queryBool(c, "axes")
+	if err != nil {
+		return nil, fmt.Errorf("invalid axes: %w", err)
+	}
+
+	if axes {
+		opts = append(opts, render.WithAxes())
+	}
+
+	start, end, err := frequencyRange(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if end > start {
+		opts = append(opts, render.FrequencyRange(start, end))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/broker"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/reference"
+	log "github.com/sirupsen/logrus"
+)
+
+// subtract returns the scan less the selected reference, or the scan as it is
+// when none is selected.
+func (p *pipeline) subtract(scan *power.Scan) *power.Scan {
+	if r := p.reference.Load(); r != nil {
+		return r.Difference(scan)
+	}
+
+	return scan
+}
+
+// selectReference makes the reference the one subtracted from the
+// difference stream, or clears it when nil, broadcasting it as a `reference`
+// event.
+func (p *pipeline) selectReference(r *reference.Reference) {
+	p.reference.Store(r)
+
+	event := broker.Event{Name: "reference", Value: r}
+	p.stream.SendEvent(event)
+	p.difference.SendEvent(event)
+}
+
+// queryReference returns the reference named by the `reference` query
+// parameter, or the selected reference.
+func (p *pipeline) queryReference(c *gin.Context) (*reference.Reference, error) {
+	if name := c.Query("reference"); name != "" {
+		r, ok := p.references.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", reference.ErrNotFound, name)
+		}
+		return r, nil
+	}
+
+	if r := p.reference.Load(); r != nil {
+		return r, nil
+	}
+
+	return nil, errors.New("no reference is selected, select one or give ?reference=")
+}
+
+// referenceError writes the response for an error of the reference library.
+func referenceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, reference.ErrInvalid):
+		c.String(http.StatusBadRequest, err.Error())
+	case errors.Is(err, reference.ErrNotFound):
+		c.String(http.StatusNotFound, err.Error())
+	default:
+		log.Errorln(err)
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// referencesHandler lists the saved references.
+func (p *pipeline) referencesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, p.references.List())
+	}
+}
+
+// referenceHandler serves the saved reference named in the path.
+func (p *pipeline) referenceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := p.references.Get(c.Param("name"))
+		if !ok {
+			c.String(http.StatusNotFound, reference.ErrNotFound.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// captureReferenceHandler averages the `from`, `to` or `last` window of the
+// history into a reference saved as `name`, replacing any of that name.
+func (p *pipeline) captureReferenceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scans, err := window(c, p.hm)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		r, err := reference.Capture(c.Query("name"), scans)
+		if err != nil {
+			referenceError(c, err)
+			return
+		}
+
+		if err := p.references.Add(r); err != nil {
+			referenceError(c, err)
+			return
+		}
+
+		// a replaced reference that was selected is replaced there too.
+		if selected := p.reference.Load(); selected != nil && selected.Name == r.Name {
+			p.selectReference(r)
+		}
+
+		c.JSON(http.StatusCreated, r)
+	}
+}
+
+// deleteReferenceHandler removes the saved reference named in the path,
+// clearing the selection when it was selected.
+func (p *pipeline) deleteReferenceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+
+		if err := p.references.Delete(name); err != nil {
+			referenceError(c, err)
+			return
+		}
+
+		if selected := p.reference.Load(); selected != nil && selected.Name == name {
+			p.selectReference(nil)
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// selectedReferenceHandler serves the selected reference, null when there is
+// none.
+func (p *pipeline) selectedReferenceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, p.reference.Load())
+	}
+}
+
+// selectReferenceHandler selects the saved reference named in the body, as
+// `{"name": "quiet"}`, or clears the selection when the name is empty.
+func (p *pipeline) selectReferenceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if body.Name == "" {
+			p.selectReference(nil)
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		r, ok := p.references.Get(body.Name)
+		if !ok {
+			c.String(http.StatusNotFound, "%v: %s", reference.ErrNotFound, body.Name)
+			return
+		}
+
+		p.selectReference(r)
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// referencesDir returns the directory of the stream's references in the data
+// directory, or empty without one.
+func referencesDir(dataDir, stream string) string {
+	if dataDir == "" {
+		return ""
+	}
+
+	return filepath.Join(dataDir, stream, "references")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/render"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxFrameRate limits the frames per second of an MJPEG stream.
+	maxFrameRate = 25
+
+	// maxTimelapseFrames and maxTimelapsePixels limit the memory taken by a
+	// time-lapse, which is held whole while it is encoded.
+	maxTimelapseFrames = 600
+	maxTimelapsePixels = 1 << 27
+)
+
+// waterfallHandler renders a window of the history as a PNG waterfall.
+func (p *pipeline) waterfallHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scans, err := p.scans(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err := waterfallOptions(c, maxImagePixels)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		img := render.NewWaterfall(opts...).Render(scans)
+
+		c.Header("Content-Type", "image/png")
+		c.Header("Cache-Control", "no-cache")
+		if err := png.Encode(c.Writer, img); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// timelapseHandler animates a window of the history as a GIF time-lapse.
+func (p *pipeline) timelapseHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scans, err := p.scans(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err := waterfallOptions(c, maxImagePixels)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		frames, err := queryInt(c, "frames", 60, maxTimelapseFrames)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		delay, err := queryDuration(c, "delay", 100*time.Millisecond)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		span, err := queryDuration(c, "window", 0)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		timelapse := render.NewTimelapse(
+			render.WithWaterfall(opts...),
+			render.Frames(frames),
+			render.FrameDelay(delay),
+			render.Window(span),
+		)
+
+		if timelapse.Width*timelapse.Height*min(frames, len(scans)) > maxTimelapsePixels {
+			c.String(http.StatusBadRequest, "the time-lapse is too large, use fewer frames or a smaller size")
+			return
+		}
+
+		anim, err := timelapse.Render(scans)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+
+		c.Header("Content-Type", "image/gif")
+		c.Header("Content-Disposition", `attachment; filename="timelapse.gif"`)
+		if err := gif.EncodeAll(c.Writer, anim); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// frameRate reads the `fps` query parameter, which may be below 1.
+func frameRate(c *gin.Context) (float64, error) {
+	value := c.Query("fps")
+	if value == "" {
+		return 1, nil
+	}
+
+	fps, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(fps > 0 && fps <= maxFrameRate) {
+		return 0, fmt.Errorf("fps must be above 0 and at most %d", maxFrameRate)
+	}
+
+	return fps, nil
+}
+
+// mjpegHandler streams the waterfall as multipart/x-mixed-replace JPEG
+// frames, which most browsers show as a continuously updating image. A frame
+// is only rendered when a sweep has completed since the last, and at most
+// `fps` times a second.
+func (p *pipeline) mjpegHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts, err := waterfallOptions(c, maxStreamPixels)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		fps, err := frameRate(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		quality, err := queryInt(c, "quality", jpeg.DefaultQuality, 100)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// validate the window before committing to the stream.
+		if _, err := p.scans(c); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		waterfall := render.NewWaterfall(opts...)
+		mw := multipart.NewWriter(c.Writer)
+
+		c.Header("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+		c.Header("Cache-Control", "no-cache")
+		c.Status(http.StatusOK)
+
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / fps))
+		defer ticker.Stop()
+
+		var buf bytes.Buffer
+		rendered := ^uint64(0)
+
+		for {
+			if sweeps := p.hm.Sweeps(); sweeps != rendered {
+				rendered = sweeps
+
+				// the window is read again so that `last` follows the newest sweep.
+				scans, _ := p.scans(c)
+
+				buf.Reset()
+				if err := jpeg.Encode(&buf, waterfall.Render(scans), &jpeg.Options{Quality: quality}); err != nil {
+					log.Errorln(err)
+					return
+				}
+
+				part, err := mw.CreatePart(textproto.MIMEHeader{
+					"Content-Type":   {"image/jpeg"},
+					"Content-Length": {strconv.Itoa(buf.Len())},
+				})
+				if err != nil {
+					return
+				}
+
+				if _, err := part.Write(buf.Bytes()); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/sdr/power/stats"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// statistics summarises the sweeps selected by the query, in its view and
+// frequency range, with the `traces` asked for or the defaults. Only the
+// sweeps with the frequencies of the newest are summarised.
+func (p *pipeline) statistics(c *gin.Context) (*stats.Statistics, []string, error) {
+	traces := stats.DefaultTraces
+	if value := c.Query("traces"); value != "" {
+		traces = strings.Split(value, ",")
+	}
+
+	if err := stats.ValidTraces(traces); err != nil {
+		return nil, nil, err
+	}
+
+	var opts []stats.Option
+	if value := c.Query("resolution"); value != "" {
+		resolution, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(unit.Decabel(resolution) >= stats.MinResolution) || math.IsInf(resolution, 0) {
+			return nil, nil, fmt.Errorf("invalid resolution %q, expected at least %v", value, stats.MinResolution)
+		}
+		opts = append(opts, stats.Resolution(unit.Decabel(resolution)))
+	}
+
+	scans, err := p.scans(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start, end, err := frequencyRange(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := stats.New(opts...)
+
+	for _, scan := range sinceLayout(scans) {
+		if end > start {
+			scan = scan.Slice(start, end)
+		}
+		s.Add(scan)
+	}
+
+	return s, traces, nil
+}
+
+// statisticsInfo holds the traces of a window of the history, with null for
+// bins without values.
+type statisticsInfo struct {
+	Start       time.Time             `json:"start"`
+	End         time.Time             `json:"end"`
+	Sweeps      int                   `json:"sweeps"`
+	Frequencies []unit.Frequency      `json:"frequencies"`
+	Traces      map[string][]*float64 `json:"traces"`
+}
+
+// statisticsHandler serves the `traces` of each bin over the time window and
+// frequency range, for plotting.
+func (p *pipeline) statisticsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, traces, err := p.statistics(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		info := statisticsInfo{
+			Start:       s.Start,
+			End:         s.End,
+			Sweeps:      s.Sweeps,
+			Frequencies: s.Frequencies(),
+			Traces:      map[string][]*float64{},
+		}
+
+		for _, name := range traces {
+			trace, _ := s.Trace(name)
+
+			values := []*float64{}
+			if trace != nil {
+				for _, bin := range trace.Bins {
+					// rounded to 0.01 dB, as in the CSV.
+					if value := math.Round(float64(bin)*100) / 100; !math.IsNaN(value) {
+						values = append(values, &value)
+					} else {
+						values = append(values, nil)
+					}
+				}
+			}
+
+			info.Traces[name] = values
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// statisticsCSVHandler serves the traces of each bin as CSV, a row per bin.
+func (p *pipeline) statisticsCSVHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, traces, err := p.statistics(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="statistics.csv"`)
+		c.Status(http.StatusOK)
+
+		if err := s.WriteCSV(c.Writer, traces); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	power_history "github.com/olistrik/numa-sdr/api/sdr/power/history"
+)
+
+// rateWindow is the number of recent sweeps the sweep rate is measured over.
+const rateWindow = 16
+
+// pipelineStats counts what happened to the input of a pipeline.
+type pipelineStats struct {
+	started time.Time
+	lines   atomic.Uint64
+	running atomic.Bool
+
+	mu     sync.Mutex
+	errors map[string]uint64
+	// arrivals holds the time the most recent sweeps completed, oldest
+	// first.
+	arrivals []time.Time
+	// bands holds the measurements of the bands in the last sweep.
+	bands map[string]band.Measurement
+}
+
+func newPipelineStats() *pipelineStats {
+	return &pipelineStats{
+		started: time.Now(),
+		errors:  map[string]uint64{},
+		bands:   map[string]band.Measurement{},
+	}
+}
+
+// errorKind names the kind of a parse or push error for the statistics.
+func errorKind(err error) string {
+	var numErr *strconv.NumError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.Is(err, power.ErrTooFewFields):
+		return "fields"
+	case errors.As(err, &timeErr):
+		return "time"
+	case errors.As(err, &numErr):
+		return "number"
+	case errors.Is(err, power_history.ErrTooManyHops):
+		return "too_many_hops"
+	case errors.Is(err, power_history.ErrTooFewHops):
+		return "too_few_hops"
+	default:
+		return "other"
+	}
+}
+
+func (stats *pipelineStats) error(err error) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.errors[errorKind(err)]++
+}
+
+// sweep records that a sweep completed now, with the samples of the bands it
+// covers.
+func (stats *pipelineStats) sweep(samples map[string]band.Sample) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	clear(stats.bands)
+	for name, sample := range samples {
+		stats.bands[name] = sample.Measurement
+	}
+
+	stats.arrivals = append(stats.arrivals, time.Now())
+	if len(stats.arrivals) > rateWindow {
+		stats.arrivals = stats.arrivals[1:]
+	}
+}
+
+// status describes the health of a pipeline.
+type status struct {
+	Stream        string            `json:"stream"`
+	Running       bool              `json:"running"`
+	Uptime        float64           `json:"uptime_seconds"`
+	Lines         uint64            `json:"lines"`
+	Errors        map[string]uint64 `json:"errors"`
+	Sweeps        uint64            `json:"sweeps"`
+	SweepRate     float64           `json:"sweep_rate"`
+	ExpectedHops  int               `json:"expected_hops"`
+	LastSweepAge  *float64          `json:"last_sweep_age_seconds"`
+	Clients       int               `json:"clients"`
+	DroppedEvents uint64            `json:"dropped_events"`
+	HistorySweeps int               `json:"history_sweeps"`
+	HistoryBytes  int               `json:"history_bytes"`
+}
+
+// lastSweep returns the time since the last sweep completed.
+func (stats *pipelineStats) lastSweep() (time.Duration, bool) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if len(stats.arrivals) == 0 {
+		return 0, false
+	}
+
+	return time.Since(stats.arrivals[len(stats.arrivals)-1]), true
+}
+
+// clients returns the clients connected to every broker of the pipeline.
+func (p *pipeline) clients() int {
+	clients := 0
+	for _, b := range p.brokers() {
+		clients += b.Clients()
+	}
+
+	return clients
+}
+
+// dropped returns the events dropped by every broker of the pipeline.
+func (p *pipeline) dropped() uint64 {
+	var dropped uint64
+	for _, b := range p.brokers() {
+		dropped += b.Dropped()
+	}
+
+	return dropped
+}
+
+func (p *pipeline) status() status {
+	stats := p.stats
+
+	s := status{
+		Stream:        p.Name,
+		Running:       stats.running.Load(),
+		Uptime:        time.Since(stats.started).Seconds(),
+		Lines:         stats.lines.Load(),
+		Sweeps:        p.hm.Sweeps(),
+		ExpectedHops:  p.hm.Hops(),
+		Clients:       p.clients(),
+		DroppedEvents: p.dropped(),
+		HistorySweeps: p.hm.Len(),
+		HistoryBytes:  p.hm.Bytes(),
+	}
+
+	if age, ok := stats.lastSweep(); ok {
+		seconds := age.Seconds()
+		s.LastSweepAge = &seconds
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	s.Errors = maps.Clone(stats.errors)
+
+	// sweeps per second over the recent sweeps.
+	if n := len(stats.arrivals); n > 1 {
+		if span := stats.arrivals[n-1].Sub(stats.arrivals[0]); span > 0 {
+			s.SweepRate = float64(n-1) / span.Seconds()
+		}
+	}
+
+	return s
+}
+
+// statusHandler reports the status of the pipeline.
+func (p *pipeline) statusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, p.status())
+	}
+}
+
+// healthHandler fails with 503 when a stream has not completed a sweep within
+// the timeout, or none at all since the timeout passed after starting.
+func healthHandler(pipelines []*pipeline, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		healthy := true
+		streams := map[string]string{}
+
+		for _, p := range pipelines {
+			age, ok := p.stats.lastSweep()
+			if !ok {
+				age = time.Since(p.stats.started)
+			}
+
+			switch {
+			case age <= timeout:
+				streams[p.Name] = "ok"
+			case ok:
+				healthy = false
+				streams[p.Name] = "no sweep for " + age.Round(time.Second).String()
+			default:
+				healthy = false
+				streams[p.Name] = "no sweep yet"
+			}
+		}
+
+		code := http.StatusOK
+		if !healthy {
+			code = http.StatusServiceUnavailable
+		}
+
+		c.JSON(code, gin.H{
+			"healthy": healthy,
+			"streams": streams,
+		})
+	}
+}
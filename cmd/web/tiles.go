@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/render"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	power_history "github.com/olistrik/numa-sdr/api/sdr/power/history"
+	"github.com/olistrik/numa-sdr/api/unit"
+	log "github.com/sirupsen/logrus"
+)
+
+// Levels used for tiles that do not ask for their own, so that neighbouring
+// tiles are coloured alike.
+const (
+	defaultTileMin unit.Decabel = -40
+	defaultTileMax unit.Decabel = 10
+)
+
+type tileKey struct {
+	render.Tile
+	start unit.Frequency
+	end   unit.Frequency
+}
+
+// tileCache keeps pooled tiles, merging each new sweep into the tiles it
+// lands in. Once full, the oldest tiles are evicted first.
+type tileCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[tileKey][][]float64
+	order   []tileKey
+
+	// updates counts the sweeps merged, so that a tile pooled while one
+	// arrived is not cached without it.
+	updates uint64
+}
+
+func newTileCache(size int) *tileCache {
+	return &tileCache{
+		size:    size,
+		entries: map[tileKey][][]float64{},
+	}
+}
+
+// get returns the cached tile, pooling it with compute when it is missing.
+func (tc *tileCache) get(key tileKey, compute func() [][]float64) [][]float64 {
+	tc.mu.Lock()
+	values, ok := tc.entries[key]
+	updates := tc.updates
+	tc.mu.Unlock()
+
+	if ok {
+		return values
+	}
+
+	values = compute()
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.updates != updates {
+		return values
+	}
+
+	if _, ok := tc.entries[key]; !ok {
+		tc.order = append(tc.order, key)
+	}
+	tc.entries[key] = values
+
+	for len(tc.entries) > tc.size && len(tc.order) > 0 {
+		delete(tc.entries, tc.order[0])
+		tc.order = tc.order[1:]
+	}
+
+	return values
+}
+
+// update merges a sweep into the cached tiles, at every zoom level, that it
+// lands in. Tiles of another frequency range are dropped instead.
+func (tc *tileCache) update(sweep *power.Scan) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.updates++
+
+	for key, values := range tc.entries {
+		if key.Y != render.TileAt(key.Zoom, sweep.DateTime) {
+			continue
+		}
+
+		if key.start != sweep.StartFrequency || key.end != sweep.EndFrequency {
+			delete(tc.entries, key)
+			continue
+		}
+
+		tc.entries[key] = key.Merge(values, sweep, key.start, key.end)
+	}
+
+	tc.order = slices.DeleteFunc(tc.order, func(key tileKey) bool {
+		_, ok := tc.entries[key]
+		return !ok
+	})
+}
+
+// parseTile reads the tile from the `zoom`, `x` and `y` path parameters,
+// where y carries the .png extension.
+func parseTile(c *gin.Context) (render.Tile, error) {
+	var tile render.Tile
+	var err error
+
+	if tile.Zoom, err = strconv.Atoi(c.Param("zoom")); err != nil {
+		return tile, fmt.Errorf("invalid zoom: %w", err)
+	}
+
+	if tile.X, err = strconv.Atoi(c.Param("x")); err != nil {
+		return tile, fmt.Errorf("invalid x: %w", err)
+	}
+
+	y, ok := strings.CutSuffix(c.Param("y"), ".png")
+	if !ok {
+		return tile, fmt.Errorf("tiles are only served as png")
+	}
+
+	if tile.Y, err = strconv.Atoi(y); err != nil {
+		return tile, fmt.Errorf("invalid y: %w", err)
+	}
+
+	if !tile.Valid() {
+		return tile, fmt.Errorf("tile %d/%d/%d is outside of the plane", tile.Zoom, tile.X, tile.Y)
+	}
+
+	return tile, nil
+}
+
+// tileHandler serves max pooled tiles of the time/frequency plane, spanning
+// the frequency range of the newest sweep.
+func tileHandler(hm *power_history.History, pyramid *render.Pyramid, cache *tileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tile, err := parseTile(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		cm := render.Viridis
+		if name := c.Query("colormap"); name != "" {
+			var ok bool
+			if cm, ok = render.ColormapByName(name); !ok {
+				c.String(http.StatusBadRequest, "unknown colormap %q, expected one of %v", name, render.ColormapNames())
+				return
+			}
+		}
+
+		lo, hi := defaultTileMin, defaultTileMax
+		if value := c.Query("min"); value != "" {
+			if err := parseDecabel(value, &lo); err != nil {
+				c.String(http.StatusBadRequest, "invalid min: %v", err)
+				return
+			}
+		}
+
+		if value := c.Query("max"); value != "" {
+			if err := parseDecabel(value, &hi); err != nil {
+				c.String(http.StatusBadRequest, "invalid max: %v", err)
+				return
+			}
+		}
+
+		head := hm.Head()
+		if head == nil {
+			c.String(http.StatusNotFound, "no sweeps yet")
+			return
+		}
+
+		key := tileKey{tile, head.StartFrequency, head.EndFrequency}
+		values := cache.get(key, func() [][]float64 {
+			return pyramid.Tile(tile, key.start, key.end)
+		})
+
+		c.Header("Content-Type", "image/png")
+		if err := png.Encode(c.Writer, render.TileImage(values, cm, lo, hi)); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// tileInfoHandler describes the tiled plane to a client.
+func tileInfoHandler(hm *power_history.History) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		head, tail := hm.Head(), hm.Tail()
+		if head == nil || tail == nil {
+			c.String(http.StatusNotFound, "no sweeps yet")
+			return
+		}
+
+		resolutions := make([]float64, render.MaxZoom+1)
+		for zoom := range resolutions {
+			resolutions[zoom] = render.Resolution(zoom).Seconds()
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"tile_size":       render.TileSize,
+			"max_zoom":        render.MaxZoom,
+			"resolutions":     resolutions,
+			"start_frequency": head.StartFrequency,
+			"end_frequency":   head.EndFrequency,
+			"from":            tail.DateTime,
+			"to":              head.DateTime,
+		})
+	}
+}
+
+func parseDecabel(value string, db *unit.Decabel) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+
+	*db = unit.Decabel(f)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certificate holds a TLS key pair that can be reloaded, so that renewed
+// certificates are picked up without a restart.
+type certificate struct {
+	certFile string
+	keyFile  string
+	current  atomic.Pointer[tls.Certificate]
+}
+
+func loadCertificate(certFile, keyFile string) (*certificate, error) {
+	cert := &certificate{certFile: certFile, keyFile: keyFile}
+	if err := cert.reload(); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// reload reads the key pair again, keeping the current one when it cannot be
+// loaded.
+func (cert *certificate) reload() error {
+	pair, err := tls.LoadX509KeyPair(cert.certFile, cert.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert.current.Store(&pair)
+	log.Infof("Loaded TLS certificate from %s", cert.certFile)
+
+	return nil
+}
+
+func (cert *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cert.current.Load(), nil
+}
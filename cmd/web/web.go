@@ -1,19 +1,30 @@
 package main
 
 import (
-	"bufio"
+	"crypto/tls"
 	"embed"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/gin-gonic/gin"
+	"github.com/olistrik/numa-sdr/api/alert"
+	"github.com/olistrik/numa-sdr/api/cmd/web/internal/auth"
 	"github.com/olistrik/numa-sdr/api/cmd/web/internal/filesystem"
-	"github.com/olistrik/numa-sdr/api/cmd/web/internal/sse"
+	"github.com/olistrik/numa-sdr/api/export"
 	"github.com/olistrik/numa-sdr/api/sdr/power"
-	power_history "github.com/olistrik/numa-sdr/api/sdr/power/history"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	"github.com/olistrik/numa-sdr/api/sdr/power/detect"
+	"github.com/olistrik/numa-sdr/api/sdr/power/floor"
+	"github.com/olistrik/numa-sdr/api/sdr/power/occupancy"
+	"github.com/olistrik/numa-sdr/api/sdr/power/profile"
+	"github.com/olistrik/numa-sdr/api/sdr/power/track"
 	"github.com/olistrik/numa-sdr/api/unit"
 	log "github.com/sirupsen/logrus"
 )
@@ -24,37 +35,100 @@ var args struct {
 	Offset  unit.Frequency `arg:"-o" default:"0" placeholder:"float"`
 	History time.Duration  `arg:"--history" default:"1h" placeholder:"duration"`
 	Title   string         `arg:"-t" default:"Numa" placeholder:"string"`
-}
 
-func processRow(callback func(*power.Scan) error) {
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		// scanner reads lines by default.
-		line := scanner.Text()
+	Streams []string `arg:"--stream,separate" placeholder:"name=input" help:"A named stream, as name=input[;offset=float][;history=duration][;title=string]. The input is a file, - for stdin, or exec:command. Reads stdin when none are given."`
 
-		// forward line
-		fmt.Println(line)
+	TileCache int `arg:"--tile-cache" default:"128" placeholder:"int"`
 
-		// parse the line
-		scan, err := power.ParseScan(line)
-		if err != nil {
-			log.Errorln(err)
-			continue
-		}
+	QuantizeStep unit.Decabel `arg:"--quantize-step" default:"0.5" placeholder:"dB" help:"The step the bins of ?encoding=quantized streams are rounded to."`
+
+	DataDir string `arg:"--data-dir" placeholder:"dir" help:"Where annotations are kept, in a directory per stream. They are lost on exit when not given."`
+
+	Alerts string `arg:"--alerts" placeholder:"file" help:"A JSON file of alert rules, reloaded on SIGHUP."`
+
+	Detect         detect.Method `arg:"--detect" placeholder:"ca|os" help:"Detect signals in every sweep with a cell averaging or ordered statistic CFAR detector."`
+	DetectGuard    int           `arg:"--detect-guard" default:"2" placeholder:"bins" help:"Guard cells on each side of the bin under test."`
+	DetectTraining int           `arg:"--detect-training" default:"8" placeholder:"bins" help:"Training cells on each side, beyond the guard cells."`
+	DetectPFA      float64       `arg:"--detect-pfa" default:"1e-6" placeholder:"float" help:"The false alarm rate of the detector."`
+	DetectRank     float64       `arg:"--detect-rank" default:"0.75" placeholder:"float" help:"The rank of the ordered statistic, as a fraction of the training cells."`
+
+	TrackGap       int            `arg:"--track-gap" default:"1" placeholder:"sweeps" help:"Sweeps an emission may go undetected before it ends."`
+	TrackTolerance unit.Frequency `arg:"--track-tolerance" default:"0" placeholder:"float" help:"How far apart, in Hz, detections of consecutive sweeps may be and still be one emission."`
+	TrackMinSweeps int            `arg:"--track-min-sweeps" default:"1" placeholder:"sweeps" help:"Sweeps an emission must be detected in to be logged."`
 
-		scan.StartFrequency += args.Offset
-		scan.EndFrequency += args.Offset
+	FloorWindow     time.Duration `arg:"--floor-window" default:"0" placeholder:"duration" help:"Estimate the noise floor of every bin over this window of sweeps, for /stream/snr, /api/floor and ?view=snr. Disabled when 0."`
+	FloorPercentile float64       `arg:"--floor-percentile" default:"0.5" placeholder:"float" help:"The percentile of each bin taken as its floor, 0.5 being the median."`
+
+	Profiles               bool          `arg:"--profiles" help:"Fold every sweep onto daily and weekly profiles of mean power and occupancy, for /api/profile, kept in --data-dir."`
+	ProfileDailySlot       time.Duration `arg:"--profile-daily-slot" default:"1h" placeholder:"duration" help:"The time of day covered by each row of the daily profile."`
+	ProfileWeeklySlot      time.Duration `arg:"--profile-weekly-slot" default:"24h" placeholder:"duration" help:"The time of the week covered by each row of the weekly profile."`
+	ProfileThreshold       *unit.Decabel `arg:"--profile-threshold" placeholder:"dB" help:"Count bins above this level as occupied in the profiles, rather than those above the noise."`
+	ProfileAboveFloor      *unit.Decabel `arg:"--profile-above-floor" placeholder:"dB" help:"Count bins this far above their own noise floor, over the last 10 minutes, as occupied in the profiles, rather than those above the noise."`
+	ProfileAboveNoise      unit.Decabel  `arg:"--profile-above-noise" default:"10" placeholder:"dB" help:"Count bins this far above the noise of their sweep as occupied in the profiles."`
+	ProfileNoisePercentile float64       `arg:"--profile-noise-percentile" default:"0.1" placeholder:"float" help:"The percentile of the bins of each sweep taken as its noise."`
+
+	Bands []string `arg:"--band,separate" placeholder:"name=start:end" help:"A band to measure in every sweep for /metrics and /stream/bands, and summarise in /api/occupancy, with the frequencies in Hz. May be repeated."`
+
+	StatusInterval time.Duration `arg:"--status-interval" default:"10s" placeholder:"duration" help:"How often status events are sent to the streams."`
+	HealthTimeout  time.Duration `arg:"--health-timeout" default:"1m" placeholder:"duration" help:"How long without a sweep before /healthz fails."`
+
+	// the station is described in the headers of FITS exports.
+	Observer   string   `arg:"--observer" placeholder:"name"`
+	Telescope  string   `arg:"--telescope" placeholder:"name"`
+	Instrument string   `arg:"--instrument" default:"rtl_power" placeholder:"name"`
+	Object     string   `arg:"--object" placeholder:"name"`
+	Latitude   *float64 `arg:"--latitude" placeholder:"deg"`
+	Longitude  *float64 `arg:"--longitude" placeholder:"deg"`
+	Elevation  *float64 `arg:"--elevation" placeholder:"m"`
+
+	Cert   string `arg:"--cert" placeholder:"file" help:"TLS certificate, reloaded on SIGHUP."`
+	Key    string `arg:"--key" placeholder:"file" help:"TLS private key, reloaded on SIGHUP."`
+	Users  string `arg:"--users" placeholder:"file" help:"htpasswd file of name:bcrypt-hash[:role] for basic auth, reloaded on SIGHUP."`
+	Tokens string `arg:"--tokens" placeholder:"file" help:"File of name:token[:role] for bearer auth, reloaded on SIGHUP."`
+}
 
-		// call the callback with the result.
-		if err := callback(scan); err != nil {
-			log.Errorln(err)
-			continue
+// quantize replaces any scans in an event value with their compact,
+// quantized representation, rounded to the --quantize-step.
+func quantize(value any) any {
+	step := args.QuantizeStep
+
+	switch value := value.(type) {
+	case *power.Scan:
+		return value.Quantize(step)
+	case []*power.Scan:
+		scans := make([]*power.QuantizedScan, len(value))
+		for i, scan := range value {
+			scans[i] = scan.Quantize(step)
 		}
+		return scans
+	default:
+		return value
+	}
+}
+
+// accessLog formats requests as gin's default logger does, with any access
+// token in the query redacted.
+func accessLog(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Errorln(err)
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
 	}
+
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		auth.RedactQuery(param.Path),
+		param.ErrorMessage,
+	)
 }
 
 //go:embed templates/*
@@ -68,50 +142,269 @@ func main() {
 	gin.DefaultWriter = log.StandardLogger().Out
 	arg.MustParse(&args)
 
-	var stream *sse.Stream
+	station := export.Station{
+		Observer:   args.Observer,
+		Telescope:  args.Telescope,
+		Instrument: args.Instrument,
+		Object:     args.Object,
+		Latitude:   args.Latitude,
+		Longitude:  args.Longitude,
+		Elevation:  args.Elevation,
+	}
 
-	hm := power_history.New(
-		power_history.MaxDuration(args.History),
-	)
+	specs := []streamSpec{{
+		Name:    "default",
+		Input:   "-",
+		Title:   args.Title,
+		Offset:  args.Offset,
+		History: args.History,
+	}}
 
-	stream = sse.NewStream(
-		sse.OnConnect(func(client sse.Client) {
-			client.Send("init", hm.Scans)
-		}),
-	)
+	if len(args.Streams) > 0 {
+		specs = specs[:0]
+		names := map[string]bool{}
+
+		for _, value := range args.Streams {
+			spec, err := parseStreamSpec(value)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			if names[spec.Name] {
+				log.Fatalf("stream %s is given twice", spec.Name)
+			}
+			names[spec.Name] = true
+
+			if spec.Input == "-" {
+				if names["-"] {
+					log.Fatalln("only one stream can read stdin")
+				}
+				names["-"] = true
+			}
 
-	go processRow(func(scan *power.Scan) error {
-		complete, err := hm.Push(scan)
+			specs = append(specs, spec)
+		}
+	}
+
+	if !(args.QuantizeStep > 0) || math.IsInf(float64(args.QuantizeStep), 0) {
+		log.Fatalln("--quantize-step must be positive")
+	}
+
+	bands := make([]band.Band, len(args.Bands))
+	for i, value := range args.Bands {
+		b, err := band.Parse(value)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if slices.ContainsFunc(bands[:i], func(other band.Band) bool { return other.Name == b.Name }) {
+			log.Fatalf("band %s is given twice", b.Name)
+		}
+
+		bands[i] = b
+	}
+
+	if args.DataDir == "" {
+		log.Warnln("--data-dir was not given, annotations and activity will be lost when the server stops.")
+	}
+
+	var alerts *alert.Engine
+	if args.Alerts != "" {
+		rules, err := alert.Load(args.Alerts)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		alerts = alert.New(rules)
+		log.Infof("Loaded %d alert rules", len(rules))
+	}
+
+	var detector *detect.Detector
+	if args.Detect != "" {
+		var err error
+		detector, err = detect.New(
+			detect.WithMethod(args.Detect),
+			detect.Guard(args.DetectGuard),
+			detect.Training(args.DetectTraining),
+			detect.FalseAlarmRate(args.DetectPFA),
+			detect.Rank(args.DetectRank),
+		)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	pipelines := make([]*pipeline, len(specs))
+	for i, spec := range specs {
+		p, err := newPipeline(spec, bands, args.DataDir)
 		if err != nil {
+			log.Fatalf("stream %s: %v", spec.Name, err)
+		}
+
+		p.alerts = alerts
+
+		if detector != nil {
+			p.detector = detector
+
+			err := p.track(args.DataDir,
+				track.Gap(args.TrackGap),
+				track.Tolerance(args.TrackTolerance),
+				track.MinSweeps(args.TrackMinSweeps),
+			)
+			if err != nil {
+				log.Fatalf("stream %s: %v", spec.Name, err)
+			}
+		}
+
+		if args.FloorWindow > 0 {
+			p.estimateFloor(
+				floor.Window(args.FloorWindow),
+				floor.Percentile(args.FloorPercentile),
+			)
+		}
+
+		if args.Profiles {
+			rule := occupancy.AboveNoise(args.ProfileAboveNoise, args.ProfileNoisePercentile)
+			switch {
+			case args.ProfileThreshold != nil:
+				rule = occupancy.Threshold(*args.ProfileThreshold)
+			case args.ProfileAboveFloor != nil:
+				rule = occupancy.AboveFloor(*args.ProfileAboveFloor)
+			}
+
+			slots := map[profile.Period]time.Duration{
+				profile.Daily:  args.ProfileDailySlot,
+				profile.Weekly: args.ProfileWeeklySlot,
+			}
+
+			if err := p.foldProfiles(args.DataDir, slots, profile.Occupied(rule)); err != nil {
+				log.Fatalf("stream %s: %v", spec.Name, err)
+			}
+		}
+
+		pipelines[i] = p
+		go p.run()
+		go p.broadcastStatus(args.StatusInterval)
+	}
+
+	authenticator, err := auth.New(args.Users, args.Tokens)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if !authenticator.Enabled() {
+		log.Warnln("Neither --users nor --tokens was given, anyone who can reach the server can use it.")
+	}
+
+	var cert *certificate
+	if args.Cert != "" || args.Key != "" {
+		if args.Cert == "" || args.Key == "" {
+			log.Fatalln("--cert and --key must be given together")
+		}
+
+		if cert, err = loadCertificate(args.Cert, args.Key); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	reload := func() error {
+		if err := authenticator.Reload(); err != nil {
 			return err
 		}
 
-		if complete {
-			stream.Send("scan", hm.Head())
+		if alerts != nil {
+			rules, err := alert.Load(args.Alerts)
+			if err != nil {
+				return err
+			}
+
+			alerts.SetRules(rules)
+			log.Infof("Loaded %d alert rules", len(rules))
+		}
+
+		if cert != nil {
+			return cert.reload()
 		}
 
 		return nil
-	})
+	}
+
+	go func() {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+
+		for range hangup {
+			log.Info("Reloading credentials and alert rules...")
+			if err := reload(); err != nil {
+				log.Errorln(err)
+			}
+		}
+	}()
 
 	log.Info("Starting webserver...")
 
-	router := gin.Default()
+	// the page authenticates its event streams with an access_token query
+	// parameter, which the default logger would write out.
+	router := gin.New()
+	router.Use(gin.LoggerWithFormatter(accessLog), gin.Recovery())
 
 	// FIX: this is temporary, LoadHTMLFS has been merged into gin, but not yet released.
 	filesystem.LoadHTMLFS(router, http.FS(templatesFS), "**/*.html.tmpl")
 
-	router.GET("/", func(c *gin.Context) {
-		c.HTML(200, "index.html.tmpl", gin.H{
-			"title": args.Title,
-		})
-	})
-
 	router.GET("/favicon.ico", func(c *gin.Context) {
 		data, _ := staticFS.ReadFile("static/favicon.ico")
 		c.Data(200, "image/x-icon", data)
 	})
 
-	router.GET("/stream/scans", stream.Handler())
+	// health checks come from load balancers and supervisors, which do not
+	// authenticate.
+	router.GET("/healthz", healthHandler(pipelines, args.HealthTimeout))
+
+	viewer := router.Group("/", authenticator.Require(auth.Viewer))
+
+	// the first stream is also served at the root, as it was before there
+	// could be several.
+	if len(pipelines) == 1 {
+		pipelines[0].page(viewer)
+	} else {
+		viewer.GET("/", streamsPageHandler(pipelines))
+	}
+	pipelines[0].routes(viewer, station)
+
+	viewer.GET("/streams", streamsPageHandler(pipelines))
+	viewer.GET("/streams.json", streamsHandler(pipelines))
+	viewer.GET("/metrics", metricsHandler(pipelines))
+
+	for _, p := range pipelines {
+		group := viewer.Group("/streams/" + p.Name)
+		p.page(group)
+		p.routes(group, station)
+	}
+
+	admin := router.Group("/admin", authenticator.Require(auth.Admin))
+
+	admin.POST("/reload", func(c *gin.Context) {
+		if err := reload(); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	})
+
+	server := &http.Server{
+		Addr:    fmt.Sprint(args.Address, ":", args.Port),
+		Handler: router,
+	}
+
+	if cert != nil {
+		server.TLSConfig = &tls.Config{
+			GetCertificate: cert.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+
+		log.Fatalln(server.ListenAndServeTLS("", ""))
+	}
 
-	router.Run(fmt.Sprint(args.Address, ":", args.Port))
+	log.Fatalln(server.ListenAndServe())
 }
@@ -0,0 +1,333 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fitsBlock = 2880
+	fitsCard  = 80
+
+	// fitsString is the longest string value of a card, once its quotes are
+	// doubled, between the quotes that start at column 11.
+	fitsString = fitsCard - 10 - 2
+)
+
+// Station describes where and how the sweeps were recorded, for the headers
+// of formats that carry it. Empty fields are left out.
+type Station struct {
+	Observer   string
+	Telescope  string
+	Instrument string
+	Object     string
+
+	// Latitude and Longitude are in degrees, Elevation in metres.
+	Latitude  *float64
+	Longitude *float64
+	Elevation *float64
+}
+
+// fitsASCII replaces what FITS headers and strings cannot hold, anything but
+// printable ASCII, with '?', so that a character is a byte.
+func fitsASCII(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, value)
+}
+
+// fitsHeader builds the cards of a FITS header.
+type fitsHeader struct {
+	cards []string
+}
+
+// card adds a card, cutting the comment short when it does not fit.
+func (h *fitsHeader) card(keyword, value, comment string) {
+	card := fmt.Sprintf("%-8s= %s", keyword, value)
+	if comment != "" && len(card)+3 < fitsCard {
+		card += " / " + fitsASCII(comment)
+	}
+
+	h.cards = append(h.cards, card[:min(len(card), fitsCard)])
+}
+
+// string adds a card of a string, which is cut short when it does not fit.
+func (h *fitsHeader) string(keyword, value, comment string) {
+	// strings are quoted, with quotes doubled, and at least 8 characters long.
+	var escaped strings.Builder
+	for _, r := range fitsASCII(value) {
+		c := string(r)
+		if r == '\'' {
+			c = "''"
+		}
+
+		if escaped.Len()+len(c) > fitsString {
+			break
+		}
+		escaped.WriteString(c)
+	}
+
+	quoted := fmt.Sprintf("'%-8s'", escaped.String())
+	h.card(keyword, fmt.Sprintf("%-20s", quoted), comment)
+}
+
+func (h *fitsHeader) bool(keyword string, value bool, comment string) {
+	logical := "F"
+	if value {
+		logical = "T"
+	}
+
+	h.card(keyword, fmt.Sprintf("%20s", logical), comment)
+}
+
+func (h *fitsHeader) int(keyword string, value int, comment string) {
+	h.card(keyword, fmt.Sprintf("%20d", value), comment)
+}
+
+func (h *fitsHeader) float(keyword string, value float64, comment string) {
+	number := strconv.FormatFloat(value, 'G', -1, 64)
+	if !strings.ContainsAny(number, ".EN") {
+		number += ".0"
+	}
+
+	h.card(keyword, fmt.Sprintf("%20s", number), comment)
+}
+
+func (h *fitsHeader) comment(text string) {
+	card := "COMMENT " + fitsASCII(text)
+	h.cards = append(h.cards, card[:min(len(card), fitsCard)])
+}
+
+// WriteTo writes the header padded to a whole block. The cards are ASCII and
+// at most fitsCard long, so are padded a byte at a time.
+func (h *fitsHeader) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, card := range append(h.cards, "END") {
+		b.WriteString(card)
+		b.WriteString(strings.Repeat(" ", fitsCard-len(card)))
+	}
+
+	if pad := b.Len() % fitsBlock; pad != 0 {
+		b.WriteString(strings.Repeat(" ", fitsBlock-pad))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// fitsPad writes the zeros that fill the data of n bytes to a whole block.
+func fitsPad(w io.Writer, n int) error {
+	if pad := n % fitsBlock; pad != 0 {
+		_, err := w.Write(make([]byte, fitsBlock-pad))
+		return err
+	}
+
+	return nil
+}
+
+// WriteFITS writes the matrix as a FITS dynamic spectrum: a float32 image in
+// dB with frequency along the first axis and time along the second, followed
+// by a TIMES table holding the exact time of each row and an ANNOTATIONS
+// table.
+func (m *Matrix) WriteFITS(w io.Writer, station Station) error {
+	bw := bufio.NewWriter(w)
+
+	times := m.Times()
+	begin := m.Scans[0].DateTime.UTC()
+	end := m.Scans[len(m.Scans)-1].DateTime.UTC()
+
+	// the time axis can only be linear, so it is given the mean interval
+	// between sweeps.
+	interval := 0.0
+	if len(times) > 1 {
+		interval = (times[len(times)-1] - times[0]) / float64(len(times)-1)
+	}
+
+	width := float64(m.End-m.Start) / float64(m.columns)
+
+	primary := &fitsHeader{}
+	primary.bool("SIMPLE", true, "conforms to FITS standard")
+	primary.int("BITPIX", -32, "32-bit floating point")
+	primary.int("NAXIS", 2, "")
+	primary.int("NAXIS1", m.Columns(), "frequency bins")
+	primary.int("NAXIS2", m.Rows(), "sweeps")
+	primary.bool("EXTEND", true, "")
+	primary.string("BUNIT", "dB", "power relative to full scale")
+
+	primary.string("CTYPE1", "FREQ", "")
+	primary.string("CUNIT1", "Hz", "")
+	primary.float("CRPIX1", 1, "")
+	primary.float("CRVAL1", float64(m.Start)+width/2, "centre of the first bin")
+	primary.float("CDELT1", width, "")
+
+	primary.string("CTYPE2", "TIME", "")
+	primary.string("CUNIT2", "s", "")
+	primary.float("CRPIX2", 1, "")
+	primary.float("CRVAL2", 0, "seconds since DATE-OBS")
+	primary.float("CDELT2", interval, "mean interval, see the TIMES table")
+
+	primary.string("TIMESYS", "UTC", "")
+	primary.string("DATEREF", begin.Format("2006-01-02T15:04:05.000"), "")
+	primary.string("DATE-OBS", begin.Format("2006-01-02T15:04:05.000"), "first sweep")
+	primary.string("DATE-END", end.Format("2006-01-02T15:04:05.000"), "last sweep")
+	primary.string("DATE", time.Now().UTC().Format("2006-01-02T15:04:05"), "file creation")
+
+	for _, keyword := range []struct{ name, value string }{
+		{"OBSERVER", station.Observer},
+		{"TELESCOP", station.Telescope},
+		{"INSTRUME", station.Instrument},
+		{"OBJECT", station.Object},
+	} {
+		if keyword.value != "" {
+			primary.string(keyword.name, keyword.value, "")
+		}
+	}
+
+	if station.Latitude != nil {
+		primary.float("SITELAT", *station.Latitude, "[deg] station latitude")
+	}
+	if station.Longitude != nil {
+		primary.float("SITELONG", *station.Longitude, "[deg] station longitude")
+	}
+	if station.Elevation != nil {
+		primary.float("SITEELEV", *station.Elevation, "[m] station elevation")
+	}
+
+	primary.string("ORIGIN", "numa", "")
+	primary.comment("rtl_power sweeps, a row per sweep and a column per bin.")
+
+	if _, err := primary.WriteTo(bw); err != nil {
+		return err
+	}
+
+	for i := range m.Rows() {
+		if err := binary.Write(bw, binary.BigEndian, m.Row(i)); err != nil {
+			return err
+		}
+	}
+
+	if err := fitsPad(bw, 4*m.Rows()*m.Columns()); err != nil {
+		return err
+	}
+
+	table := &fitsHeader{}
+	table.string("XTENSION", "BINTABLE", "binary table extension")
+	table.int("BITPIX", 8, "")
+	table.int("NAXIS", 2, "")
+	table.int("NAXIS1", 8, "bytes per row")
+	table.int("NAXIS2", len(times), "sweeps")
+	table.int("PCOUNT", 0, "")
+	table.int("GCOUNT", 1, "")
+	table.int("TFIELDS", 1, "")
+	table.string("TTYPE1", "TIME", "")
+	table.string("TFORM1", "1D", "")
+	table.string("TUNIT1", "s", "seconds since DATE-OBS")
+	table.string("EXTNAME", "TIMES", "")
+
+	if _, err := table.WriteTo(bw); err != nil {
+		return err
+	}
+
+	for _, t := range times {
+		if err := binary.Write(bw, binary.BigEndian, t-times[0]); err != nil {
+			return err
+		}
+	}
+
+	if err := fitsPad(bw, 8*len(times)); err != nil {
+		return err
+	}
+
+	if err := m.writeAnnotationsFITS(bw, times[0]); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// writeAnnotationsFITS writes the annotations as a binary table, with times in
+// seconds since the first sweep and strings as wide as the longest of each.
+// Characters of the strings that are not printable ASCII are replaced by '?'.
+func (m *Matrix) writeAnnotationsFITS(w io.Writer, epoch float64) error {
+	ids, labels, authors := 1, 1, 1
+	for _, a := range m.Annotations {
+		ids = max(ids, len(fitsASCII(a.ID)))
+		labels = max(labels, len(fitsASCII(a.Label)))
+		authors = max(authors, len(fitsASCII(a.Author)))
+	}
+
+	width := 4*8 + ids + labels + authors + 7
+
+	table := &fitsHeader{}
+	table.string("XTENSION", "BINTABLE", "binary table extension")
+	table.int("BITPIX", 8, "")
+	table.int("NAXIS", 2, "")
+	table.int("NAXIS1", width, "bytes per row")
+	table.int("NAXIS2", len(m.Annotations), "annotations")
+	table.int("PCOUNT", 0, "")
+	table.int("GCOUNT", 1, "")
+	table.int("TFIELDS", 8, "")
+
+	columns := []struct{ name, form, unit string }{
+		{"TSTART", "1D", "s"},
+		{"TEND", "1D", "s"},
+		{"FSTART", "1D", "Hz"},
+		{"FEND", "1D", "Hz"},
+		{"ID", fmt.Sprintf("%dA", ids), ""},
+		{"LABEL", fmt.Sprintf("%dA", labels), ""},
+		{"AUTHOR", fmt.Sprintf("%dA", authors), ""},
+		{"COLOUR", "7A", ""},
+	}
+
+	for i, column := range columns {
+		n := strconv.Itoa(i + 1)
+		table.string("TTYPE"+n, column.name, "")
+		table.string("TFORM"+n, column.form, "")
+		if column.unit != "" {
+			table.string("TUNIT"+n, column.unit, "")
+		}
+	}
+
+	table.string("EXTNAME", "ANNOTATIONS", "")
+	table.comment("Times are seconds since DATE-OBS.")
+
+	if _, err := table.WriteTo(w); err != nil {
+		return err
+	}
+
+	// strings are padded with spaces.
+	str := func(value string, width int) []byte {
+		b := []byte(strings.Repeat(" ", width))
+		copy(b, fitsASCII(value))
+		return b
+	}
+
+	for _, a := range m.Annotations {
+		fields := []any{
+			unixSeconds(a.Start) - epoch,
+			unixSeconds(a.End) - epoch,
+			float64(a.StartFrequency),
+			float64(a.EndFrequency),
+			str(a.ID, ids),
+			str(a.Label, labels),
+			str(a.Author, authors),
+			str(a.Colour, 7),
+		}
+
+		for _, field := range fields {
+			if err := binary.Write(w, binary.BigEndian, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fitsPad(w, width*len(m.Annotations))
+}
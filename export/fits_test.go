@@ -0,0 +1,195 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+func TestFitsHeaderCards(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(h *fitsHeader)
+		want string
+	}{
+		{
+			name: "string",
+			add:  func(h *fitsHeader) { h.string("TELESCOP", "dish", "") },
+			want: "TELESCOP= 'dish    '",
+		},
+		{
+			name: "quotes",
+			add:  func(h *fitsHeader) { h.string("OBSERVER", "O'Brien", "") },
+			want: "OBSERVER= 'O''Brien'",
+		},
+		{
+			name: "not ascii",
+			add:  func(h *fitsHeader) { h.string("OBJECT", "Zoë ☕", "") },
+			want: "OBJECT  = 'Zo? ?   '",
+		},
+		{
+			name: "too long",
+			add:  func(h *fitsHeader) { h.string("OBJECT", strings.Repeat("x", 100), "") },
+			want: "OBJECT  = '" + strings.Repeat("x", 68) + "'",
+		},
+		{
+			name: "a quote is not split",
+			add:  func(h *fitsHeader) { h.string("OBJECT", strings.Repeat("x", 67)+"'", "") },
+			want: "OBJECT  = '" + strings.Repeat("x", 67) + "'",
+		},
+		{
+			name: "comment",
+			add:  func(h *fitsHeader) { h.int("NAXIS", 2, "axes") },
+			want: "NAXIS   =                    2 / axes",
+		},
+		{
+			name: "comment cut short",
+			add:  func(h *fitsHeader) { h.float("CDELT1", 1.5, strings.Repeat("c", 80)) },
+			want: "CDELT1  =                  1.5 / " + strings.Repeat("c", 47),
+		},
+		{
+			name: "no room for a comment",
+			add:  func(h *fitsHeader) { h.string("OBJECT", strings.Repeat("x", 68), "dropped") },
+			want: "OBJECT  = '" + strings.Repeat("x", 68) + "'",
+		},
+		{
+			name: "logical",
+			add:  func(h *fitsHeader) { h.bool("SIMPLE", true, "") },
+			want: "SIMPLE  =                    T",
+		},
+		{
+			name: "float",
+			add:  func(h *fitsHeader) { h.float("CRPIX1", 1, "") },
+			want: "CRPIX1  =                  1.0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &fitsHeader{}
+			test.add(h)
+
+			var buf bytes.Buffer
+			if _, err := h.WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.Len() != fitsBlock {
+				t.Fatalf("the header is %d bytes, want a block of %d", buf.Len(), fitsBlock)
+			}
+
+			for i, b := range buf.Bytes() {
+				if b < ' ' || b > '~' {
+					t.Fatalf("byte %d of the header is %#x, which is not printable ASCII", i, b)
+				}
+			}
+
+			card := buf.String()[:fitsCard]
+			if want := test.want + strings.Repeat(" ", fitsCard-len(test.want)); card != want {
+				t.Errorf("card is\n%q, want\n%q", card, want)
+			}
+
+			if end := buf.String()[fitsCard : 2*fitsCard]; strings.TrimRight(end, " ") != "END" {
+				t.Errorf("the card after is %q, want END", end)
+			}
+		})
+	}
+}
+
+// fitsCards reads the cards of a header from the start of data, returning
+// them by keyword and the length of the header.
+func fitsCards(t *testing.T, data []byte) (map[string]string, int) {
+	cards := map[string]string{}
+
+	for offset := 0; offset+fitsCard <= len(data); offset += fitsCard {
+		card := string(data[offset : offset+fitsCard])
+		keyword := strings.TrimSpace(card[:8])
+
+		if keyword == "END" {
+			length := offset + fitsCard
+			return cards, (length + fitsBlock - 1) / fitsBlock * fitsBlock
+		}
+
+		if card[8:10] == "= " {
+			value, _, _ := strings.Cut(card[10:], " /")
+			cards[keyword] = strings.TrimSpace(value)
+		}
+	}
+
+	t.Fatal("the header has no END card")
+	return nil, 0
+}
+
+func TestWriteFITS(t *testing.T) {
+	epoch := time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)
+
+	m, err := NewMatrix([]*power.Scan{
+		{DateTime: epoch, StartFrequency: 1e6, EndFrequency: 4e6, Bins: []unit.Decabel{-1, -2, -3}},
+		{DateTime: epoch.Add(2 * time.Second), StartFrequency: 1e6, EndFrequency: 4e6, Bins: []unit.Decabel{-4, -5, -6}},
+	}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteFITS(&buf, Station{Observer: "Zoë"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if len(data)%fitsBlock != 0 {
+		t.Fatalf("the file is %d bytes, not a whole number of blocks", len(data))
+	}
+
+	primary, length := fitsCards(t, data)
+
+	for keyword, want := range map[string]string{
+		"SIMPLE":   "T",
+		"BITPIX":   "-32",
+		"NAXIS":    "2",
+		"NAXIS1":   "3",
+		"NAXIS2":   "2",
+		"CRVAL1":   "1.5E+06",
+		"CDELT1":   "1E+06",
+		"CDELT2":   "2.0",
+		"DATE-OBS": "'2024-05-02T03:00:00.000'",
+		"OBSERVER": "'Zo?     '",
+	} {
+		if got := primary[keyword]; got != want {
+			t.Errorf("%s = %s, want %s", keyword, got, want)
+		}
+	}
+
+	// frequency along the first axis, so a row per sweep, big endian.
+	image := make([]float32, 6)
+	if err := binary.Read(bytes.NewReader(data[length:]), binary.BigEndian, image); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []float32{-1, -2, -3, -4, -5, -6} {
+		if image[i] != want {
+			t.Errorf("pixel %d is %v, want %v", i, image[i], want)
+		}
+	}
+
+	// the image is padded to a block, followed by the TIMES table.
+	offset := length + fitsBlock
+	times, length := fitsCards(t, data[offset:])
+	if times["EXTNAME"] != "'TIMES   '" || times["NAXIS2"] != "2" {
+		t.Errorf("the extension after the image is %s of %s rows, want TIMES of 2", times["EXTNAME"], times["NAXIS2"])
+	}
+
+	offsets := make([]float64, 2)
+	if err := binary.Read(bytes.NewReader(data[offset+length:]), binary.BigEndian, offsets); err != nil {
+		t.Fatal(err)
+	}
+
+	if offsets[0] != 0 || offsets[1] != 2 {
+		t.Errorf("the times are %v, want [0 2]", offsets)
+	}
+}
@@ -0,0 +1,130 @@
+// Package export writes sweeps in the formats of other tools.
+package export
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/annotation"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Matrix is a time by frequency view of sweeps, one row per sweep and one
+// column per bin. The columns are those of the first sweep. NewMatrix only
+// keeps sweeps of the same layout, but others with fewer bins are padded with
+// NaN and those with more are cut short.
+type Matrix struct {
+	Scans []*power.Scan
+
+	// Start and End are the frequencies of the columns.
+	Start unit.Frequency
+	End   unit.Frequency
+
+	// Annotations are written alongside the sweeps by formats that can hold
+	// them.
+	Annotations []annotation.Annotation
+
+	columns int
+}
+
+// NewMatrix selects the bins of the scans overlapping [start, end). When end
+// is 0 the matrix covers every bin. Only the scans since the frequencies or
+// number of bins last changed, those with the layout of the newest, are
+// kept.
+func NewMatrix(scans []*power.Scan, start, end unit.Frequency) (*Matrix, error) {
+	if len(scans) == 0 {
+		return nil, fmt.Errorf("no sweeps to export")
+	}
+
+	first := len(scans)
+	for first > 0 && scans[first-1].SameLayout(scans[len(scans)-1]) {
+		first--
+	}
+	scans = scans[first:]
+
+	if end > start {
+		sliced := make([]*power.Scan, len(scans))
+		for i, scan := range scans {
+			sliced[i] = scan.Slice(start, end)
+		}
+		scans = sliced
+	}
+
+	if len(scans[0].Bins) == 0 {
+		return nil, fmt.Errorf("no bins within the frequency range")
+	}
+
+	return &Matrix{
+		Scans:   scans,
+		Start:   scans[0].StartFrequency,
+		End:     scans[0].EndFrequency,
+		columns: len(scans[0].Bins),
+	}, nil
+}
+
+// Annotate sets the annotations of the matrix to those that overlap its time
+// and frequency range.
+func (m *Matrix) Annotate(annotations []annotation.Annotation) {
+	first, last := m.Scans[0].DateTime, m.Scans[len(m.Scans)-1].DateTime
+
+	m.Annotations = nil
+	for _, a := range annotations {
+		if a.Overlaps(first, last) && a.EndFrequency >= m.Start && a.StartFrequency <= m.End {
+			m.Annotations = append(m.Annotations, a)
+		}
+	}
+}
+
+// Rows returns the number of sweeps.
+func (m *Matrix) Rows() int {
+	return len(m.Scans)
+}
+
+// Columns returns the number of bins of each sweep.
+func (m *Matrix) Columns() int {
+	return m.columns
+}
+
+// Frequencies returns the lower edge of each column in Hz.
+func (m *Matrix) Frequencies() []float64 {
+	width := (m.End - m.Start) / unit.Frequency(m.columns)
+
+	frequencies := make([]float64, m.columns)
+	for i := range frequencies {
+		frequencies[i] = float64(m.Start + width*unit.Frequency(i))
+	}
+
+	return frequencies
+}
+
+// Times returns the time of each row in seconds since the unix epoch.
+func (m *Matrix) Times() []float64 {
+	times := make([]float64, len(m.Scans))
+	for i, scan := range m.Scans {
+		times[i] = unixSeconds(scan.DateTime)
+	}
+
+	return times
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// Row returns the bins of the i-th sweep in dB.
+func (m *Matrix) Row(i int) []float32 {
+	bins := m.Scans[i].Bins
+
+	row := make([]float32, m.columns)
+	for col := range row {
+		if col < len(bins) {
+			row[col] = float32(bins[col])
+		} else {
+			row[col] = float32(math.NaN())
+		}
+	}
+
+	return row
+}
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"testing"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+func TestNewMatrix(t *testing.T) {
+	epoch := time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)
+
+	// a sweep of a bin per MHz, at the given second.
+	sweep := func(second int, start, end unit.Frequency) *power.Scan {
+		return &power.Scan{
+			DateTime:       epoch.Add(time.Duration(second) * time.Second),
+			StartFrequency: start,
+			EndFrequency:   end,
+			Bins:           make([]unit.Decabel, int((end-start)/1e6)),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		scans      []*power.Scan
+		start, end unit.Frequency
+
+		err        bool
+		rows       int
+		columns    int
+		from, to   unit.Frequency
+		firstSweep int
+	}{
+		{
+			name: "no sweeps",
+			err:  true,
+		},
+		{
+			name:    "every bin",
+			scans:   []*power.Scan{sweep(0, 1e6, 5e6), sweep(1, 1e6, 5e6)},
+			rows:    2,
+			columns: 4,
+			from:    1e6,
+			to:      5e6,
+		},
+		{
+			name:    "a frequency range",
+			scans:   []*power.Scan{sweep(0, 1e6, 5e6), sweep(1, 1e6, 5e6)},
+			start:   2e6,
+			end:     4e6,
+			rows:    2,
+			columns: 2,
+			from:    2e6,
+			to:      4e6,
+		},
+		{
+			name:  "outside the sweeps",
+			scans: []*power.Scan{sweep(0, 1e6, 5e6)},
+			start: 10e6,
+			end:   20e6,
+			err:   true,
+		},
+		{
+			name:       "retuned",
+			scans:      []*power.Scan{sweep(0, 1e6, 5e6), sweep(1, 1e6, 5e6), sweep(2, 2e6, 8e6), sweep(3, 2e6, 8e6)},
+			rows:       2,
+			columns:    6,
+			from:       2e6,
+			to:         8e6,
+			firstSweep: 2,
+		},
+		{
+			name:       "retuned and back",
+			scans:      []*power.Scan{sweep(0, 1e6, 5e6), sweep(1, 2e6, 8e6), sweep(2, 1e6, 5e6)},
+			rows:       1,
+			columns:    4,
+			from:       1e6,
+			to:         5e6,
+			firstSweep: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewMatrix(test.scans, test.start, test.end)
+			if test.err {
+				if err == nil {
+					t.Fatalf("got a matrix, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.Rows() != test.rows || m.Columns() != test.columns {
+				t.Errorf("%d by %d, want %d by %d", m.Rows(), m.Columns(), test.rows, test.columns)
+			}
+
+			if m.Start != test.from || m.End != test.to {
+				t.Errorf("covers %v to %v, want %v to %v", m.Start, m.End, test.from, test.to)
+			}
+
+			if got, want := m.Scans[0].DateTime, test.scans[test.firstSweep].DateTime; !got.Equal(want) {
+				t.Errorf("starts at %v, want %v", got, want)
+			}
+		})
+	}
+}
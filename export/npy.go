@@ -0,0 +1,182 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// npyHeader returns the header of a version 1.0 .npy file holding a little
+// endian array of the type and shape. The type is a Python literal, such as
+// '<f8' or a list of fields.
+func npyHeader(descr string, shape ...int) []byte {
+	dims := make([]string, len(shape))
+	for i, n := range shape {
+		dims[i] = fmt.Sprint(n)
+	}
+
+	tuple := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		tuple += ","
+	}
+
+	dict := fmt.Sprintf("{'descr': %s, 'fortran_order': False, 'shape': (%s), }", descr, tuple)
+
+	// the header is padded with spaces and ends with a newline, so that the
+	// data is aligned to 64 bytes.
+	const prefix = 10
+	pad := 64 - (prefix+len(dict)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	dict += strings.Repeat(" ", pad) + "\n"
+
+	header := make([]byte, prefix, prefix+len(dict))
+	copy(header, "\x93NUMPY\x01\x00")
+	binary.LittleEndian.PutUint16(header[8:], uint16(len(dict)))
+
+	return append(header, dict...)
+}
+
+// WriteNpy writes a one dimensional array of float64 as a .npy file.
+func WriteNpy(w io.Writer, values []float64) error {
+	if _, err := w.Write(npyHeader("'<f8'", len(values))); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, values)
+}
+
+// WriteNpy writes the matrix as a .npy file of float32 in dB, with a row per
+// sweep.
+func (m *Matrix) WriteNpy(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.Write(npyHeader("'<f4'", m.Rows(), m.Columns())); err != nil {
+		return err
+	}
+
+	for i := range m.Rows() {
+		if err := binary.Write(bw, binary.LittleEndian, m.Row(i)); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteNpy2 writes a two dimensional array of float64 as a .npy file. The
+// rows must all be as long as the first.
+func WriteNpy2(w io.Writer, rows [][]float64) error {
+	columns := 0
+	if len(rows) > 0 {
+		columns = len(rows[0])
+	}
+
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.Write(npyHeader("'<f8'", len(rows), columns)); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := binary.Write(bw, binary.LittleEndian, row); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Array is a named array of a .npz archive, written as a .npy file.
+type Array struct {
+	Name  string
+	Write func(io.Writer) error
+}
+
+// WriteNpzArrays writes a .npz archive of the arrays.
+func WriteNpzArrays(w io.Writer, arrays ...Array) error {
+	zw := zip.NewWriter(w)
+
+	for _, array := range arrays {
+		file, err := zw.Create(array.Name + ".npy")
+		if err != nil {
+			return err
+		}
+
+		if err := array.Write(file); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// WriteNpz writes a .npz archive holding the matrix as `power`, the time of
+// each row as `times`, the frequency of each column as `frequencies` and the
+// annotations as `annotations`.
+func (m *Matrix) WriteNpz(w io.Writer) error {
+	return WriteNpzArrays(w,
+		Array{"power", m.WriteNpy},
+		Array{"times", func(w io.Writer) error { return WriteNpy(w, m.Times()) }},
+		Array{"frequencies", func(w io.Writer) error { return WriteNpy(w, m.Frequencies()) }},
+		Array{"annotations", m.WriteAnnotationsNpy},
+	)
+}
+
+// WriteAnnotationsNpy writes the annotations as a .npy structured array, with
+// times in unix seconds, frequencies in Hz and unicode strings as wide as the
+// longest of each.
+func (m *Matrix) WriteAnnotationsNpy(w io.Writer) error {
+	ids, labels, authors := 1, 1, 1
+	for _, a := range m.Annotations {
+		ids = max(ids, utf8.RuneCountInString(a.ID))
+		labels = max(labels, utf8.RuneCountInString(a.Label))
+		authors = max(authors, utf8.RuneCountInString(a.Author))
+	}
+
+	descr := fmt.Sprintf("[('id', '<U%d'), ('start', '<f8'), ('end', '<f8'), "+
+		"('start_frequency', '<f8'), ('end_frequency', '<f8'), "+
+		"('label', '<U%d'), ('author', '<U%d'), ('colour', '<U7')]", ids, labels, authors)
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(npyHeader(descr, len(m.Annotations))); err != nil {
+		return err
+	}
+
+	// unicode strings are UTF-32, padded with zeros.
+	str := func(value string, width int) []uint32 {
+		runes := make([]uint32, width)
+		for i, r := range []rune(value) {
+			if i < width {
+				runes[i] = uint32(r)
+			}
+		}
+		return runes
+	}
+
+	for _, a := range m.Annotations {
+		fields := []any{
+			str(a.ID, ids),
+			unixSeconds(a.Start),
+			unixSeconds(a.End),
+			float64(a.StartFrequency),
+			float64(a.EndFrequency),
+			str(a.Label, labels),
+			str(a.Author, authors),
+			str(a.Colour, 7),
+		}
+
+		for _, field := range fields {
+			if err := binary.Write(bw, binary.LittleEndian, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+func TestNpyHeader(t *testing.T) {
+	tests := []struct {
+		descr string
+		shape []int
+		dict  string
+	}{
+		{"'<f8'", []int{3}, "{'descr': '<f8', 'fortran_order': False, 'shape': (3,), }"},
+		{"'<f4'", []int{2, 16}, "{'descr': '<f4', 'fortran_order': False, 'shape': (2, 16), }"},
+		{"'<f4'", []int{0, 0}, "{'descr': '<f4', 'fortran_order': False, 'shape': (0, 0), }"},
+	}
+
+	for _, test := range tests {
+		header := npyHeader(test.descr, test.shape...)
+
+		if len(header)%64 != 0 {
+			t.Errorf("header of %v is %d bytes, not a multiple of 64", test.shape, len(header))
+		}
+
+		if !bytes.HasPrefix(header, []byte("\x93NUMPY\x01\x00")) {
+			t.Errorf("header of %v starts %q", test.shape, header[:8])
+		}
+
+		if n := int(binary.LittleEndian.Uint16(header[8:])); n != len(header)-10 {
+			t.Errorf("header of %v gives its length as %d, want %d", test.shape, n, len(header)-10)
+		}
+
+		dict := header[10:]
+		if !bytes.HasPrefix(dict, []byte(test.dict)) || dict[len(dict)-1] != '\n' || len(bytes.TrimSpace(dict)) != len(test.dict) {
+			t.Errorf("header of %v is %q, want %q padded with spaces and a newline", test.shape, dict, test.dict)
+		}
+	}
+}
+
+func TestMatrixWriteNpy(t *testing.T) {
+	epoch := time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)
+	nan := unit.Decabel(math.NaN())
+
+	m, err := NewMatrix([]*power.Scan{
+		{DateTime: epoch, StartFrequency: 1e6, EndFrequency: 4e6, Bins: []unit.Decabel{-1, -2, -3}},
+		{DateTime: epoch.Add(time.Second), StartFrequency: 1e6, EndFrequency: 4e6, Bins: []unit.Decabel{-4, nan, -6}},
+	}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteNpy(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	header := npyHeader("'<f4'", 2, 3)
+	if !bytes.HasPrefix(buf.Bytes(), header) {
+		t.Fatalf("the header is not that of a 2 by 3 float32 array")
+	}
+
+	data := make([]float32, 6)
+	if err := binary.Read(bytes.NewReader(buf.Bytes()[len(header):]), binary.LittleEndian, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// a row per sweep, in C order.
+	want := []float32{-1, -2, -3, -4, float32(math.NaN()), -6}
+	for i := range want {
+		if data[i] != want[i] && !(math.IsNaN(float64(data[i])) && math.IsNaN(float64(want[i]))) {
+			t.Errorf("element %d is %v, want %v", i, data[i], want[i])
+		}
+	}
+}
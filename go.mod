@@ -8,10 +8,12 @@ require (
 	github.com/charmbracelet/bubbletea v1.2.2
 	github.com/charmbracelet/lipgloss v1.0.0
 	github.com/gin-gonic/gin v1.10.1-0.20250707092047-76dd08d51250
+	github.com/gorilla/websocket v1.5.3
 	github.com/lrstanley/bubblezone v0.0.0-20240914071701-b48c55a5e78e
 	github.com/pothosware/go-soapy-sdr v0.7.4
 	github.com/scientificgo/fft v0.0.2
 	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/crypto v0.39.0
 )
 
 require (
@@ -51,7 +53,6 @@ require (
 	github.com/ugorji/go/codec v1.3.0 // indirect
 	go.uber.org/mock v0.5.2 // indirect
 	golang.org/x/arch v0.18.0 // indirect
-	golang.org/x/crypto v0.39.0 // indirect
 	golang.org/x/mod v0.25.0 // indirect
 	golang.org/x/net v0.41.0 // indirect
 	golang.org/x/sync v0.15.0 // indirect
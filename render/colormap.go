@@ -0,0 +1,87 @@
+package render
+
+import (
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Colormap maps a value between 0 and 1 to a colour.
+type Colormap []color.RGBA
+
+// At returns the colour for t, interpolating linearly between the stops of
+// the colormap. Values outside [0, 1] are clamped.
+func (cm Colormap) At(t float64) color.RGBA {
+	if math.IsNaN(t) {
+		t = 0
+	}
+	t = max(0, min(1, t))
+
+	pos := t * float64(len(cm)-1)
+	i := int(pos)
+	if i >= len(cm)-1 {
+		return cm[len(cm)-1]
+	}
+
+	frac := pos - float64(i)
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*frac))
+	}
+
+	a, b := cm[i], cm[i+1]
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
+
+func hex(value uint32) color.RGBA {
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}
+}
+
+var (
+	Gray = Colormap{hex(0x000000), hex(0xffffff)}
+
+	Viridis = Colormap{
+		hex(0x440154), hex(0x472c7a), hex(0x3b518b), hex(0x2c718e), hex(0x21908d),
+		hex(0x27ad81), hex(0x5cc863), hex(0xaadc32), hex(0xfde725),
+	}
+
+	Inferno = Colormap{
+		hex(0x000004), hex(0x1f0c48), hex(0x550f6d), hex(0x88226a), hex(0xba3655),
+		hex(0xe35933), hex(0xf98e09), hex(0xf8c931), hex(0xfcffa4),
+	}
+
+	Magma = Colormap{
+		hex(0x000004), hex(0x1c1044), hex(0x4f127b), hex(0x812581), hex(0xb5367a),
+		hex(0xe55964), hex(0xfb8761), hex(0xfec287), hex(0xfcfdbf),
+	}
+
+	Turbo = Colormap{
+		hex(0x30123b), hex(0x4662d7), hex(0x36aaf9), hex(0x1ae4b6), hex(0x72fe5e),
+		hex(0xc7ef34), hex(0xfaba39), hex(0xf66b19), hex(0x7a0403),
+	}
+)
+
+var colormaps = map[string]Colormap{
+	"gray":    Gray,
+	"viridis": Viridis,
+	"inferno": Inferno,
+	"magma":   Magma,
+	"turbo":   Turbo,
+}
+
+// ColormapByName returns the named colormap.
+func ColormapByName(name string) (Colormap, bool) {
+	cm, ok := colormaps[strings.ToLower(name)]
+	return cm, ok
+}
+
+// ColormapNames returns the names accepted by ColormapByName.
+func ColormapNames() []string {
+	names := make([]string, 0, len(colormaps))
+	for name := range colormaps {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
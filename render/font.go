@@ -0,0 +1,113 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"unicode"
+)
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+
+	// advance is the horizontal space taken by a glyph, including spacing.
+	advance = glyphWidth + 1
+)
+
+// glyphs is a tiny 3x5 bitmap font, enough for axis labels and timestamps.
+// Lower case letters are drawn with their upper case glyph.
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", ".##", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'C': {".##", "#..", "#..", "#..", ".##"},
+	'D': {"##.", "#.#", "#.#", "#.#", "##."},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#..", "#.."},
+	'G': {".##", "#..", "#.#", "#.#", ".##"},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", ".#.", "###"},
+	'J': {"..#", "..#", "..#", "#.#", ".#."},
+	'K': {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'L': {"#..", "#..", "#..", "#..", "###"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'N': {"##.", "#.#", "#.#", "#.#", "#.#"},
+	'O': {".#.", "#.#", "#.#", "#.#", ".#."},
+	'P': {"##.", "#.#", "##.", "#..", "#.."},
+	'Q': {".#.", "#.#", "#.#", "##.", ".##"},
+	'R': {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S': {".##", "#..", ".#.", "..#", "##."},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "#.#", "###"},
+	'V': {"#.#", "#.#", "#.#", "#.#", ".#."},
+	'W': {"#.#", "#.#", "###", "###", "#.#"},
+	'X': {"#.#", "#.#", ".#.", "#.#", "#.#"},
+	'Y': {"#.#", "#.#", ".#.", ".#.", ".#."},
+	'Z': {"###", "..#", ".#.", "#..", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	',': {"...", "...", "...", ".#.", "#.."},
+	':': {"...", ".#.", "...", ".#.", "..."},
+	'-': {"...", "...", "###", "...", "..."},
+	'+': {"...", ".#.", "###", ".#.", "..."},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	'(': {".#.", "#..", "#..", "#..", ".#."},
+	')': {".#.", "..#", "..#", "..#", ".#."},
+	'%': {"#.#", "..#", ".#.", "#..", "#.#"},
+	'_': {"...", "...", "...", "...", "###"},
+	'µ': {"...", "#.#", "#.#", "##.", "#.."},
+	' ': {"...", "...", "...", "...", "..."},
+}
+
+// textWidth returns the width in pixels of the text drawn at the given scale.
+func textWidth(text string, scale int) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+
+	return (n*advance - 1) * scale
+}
+
+// textHeight returns the height in pixels of a line of text at the given
+// scale.
+func textHeight(scale int) int {
+	return glyphHeight * scale
+}
+
+// drawText draws the text with its top left corner at p. Characters without
+// a glyph are drawn as a blank.
+func drawText(dst draw.Image, p image.Point, text string, c color.Color, scale int) {
+	src := image.NewUniform(c)
+
+	for i, r := range []rune(text) {
+		glyph, ok := glyphs[r]
+		if !ok {
+			glyph, ok = glyphs[unicode.ToUpper(r)]
+		}
+		if !ok {
+			glyph = glyphs[' ']
+		}
+
+		x0 := p.X + i*advance*scale
+		for y, row := range glyph {
+			for x, bit := range row {
+				if bit != '#' {
+					continue
+				}
+
+				rect := image.Rect(x0+x*scale, p.Y+y*scale, x0+(x+1)*scale, p.Y+(y+1)*scale)
+				draw.Draw(dst, rect, src, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Pyramid keeps the sweeps pooled to the row resolution of every zoom level,
+// each level max pooling the rows of the level below, so that a tile at any
+// zoom is pooled from at most TileSize rows. Rows keep every bin; frequency is
+// pooled as a tile is drawn.
+type Pyramid struct {
+	mu     sync.RWMutex
+	levels [MaxZoom + 1][]pyramidRow
+}
+
+type pyramidRow struct {
+	scan *power.Scan
+
+	// owned is set once the scan is a copy made by the pyramid, which may be
+	// merged into in place. Until then it is shared with the level below, or
+	// is the sweep itself.
+	owned bool
+}
+
+// bucket returns the start of the row covering t at the zoom level.
+func bucket(zoom int, t time.Time) time.Time {
+	epoch := time.Unix(0, 0)
+	return epoch.Add(t.Sub(epoch).Truncate(Resolution(zoom)))
+}
+
+// Add pools a sweep into every level. A sweep with a different layout from
+// the last starts the pyramid afresh.
+func (p *Pyramid) Add(sweep *power.Scan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if rows := p.levels[MaxZoom]; len(rows) > 0 && !rows[len(rows)-1].scan.SameLayout(sweep) {
+		for zoom := range p.levels {
+			p.levels[zoom] = nil
+		}
+	}
+
+	changed := sweep
+	for zoom := MaxZoom; zoom >= 0; zoom-- {
+		changed = p.merge(zoom, changed)
+	}
+}
+
+// merge max pools a row of the level below into the level, returning the row
+// of the level it landed in.
+func (p *Pyramid) merge(zoom int, scan *power.Scan) *power.Scan {
+	rows := p.levels[zoom]
+	at := bucket(zoom, scan.DateTime)
+
+	if len(rows) == 0 || !bucket(zoom, rows[len(rows)-1].scan.DateTime).Equal(at) {
+		p.levels[zoom] = append(rows, pyramidRow{scan: scan})
+		return scan
+	}
+
+	last := &rows[len(rows)-1]
+	if last.scan == scan {
+		return scan
+	}
+
+	if !last.owned {
+		pooled := *last.scan
+		pooled.DateTime = at
+		pooled.Bins = slices.Clone(last.scan.Bins)
+		last.scan, last.owned = &pooled, true
+	}
+
+	for i, bin := range scan.Bins {
+		if bin > last.scan.Bins[i] || math.IsNaN(float64(last.scan.Bins[i])) {
+			last.scan.Bins[i] = bin
+		}
+	}
+
+	return last.scan
+}
+
+// Trim drops the rows that end before t, so that the pyramid holds about as
+// much as the history it is fed from.
+func (p *Pyramid) Trim(t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for zoom, rows := range p.levels {
+		i := 0
+		for i < len(rows) && !bucket(zoom, rows[i].scan.DateTime).Add(Resolution(zoom)).After(t) {
+			i++
+		}
+
+		p.levels[zoom] = rows[i:]
+	}
+}
+
+// Tile max pools the tile from the rows of its zoom level, where [start, end)
+// is the frequency range of the whole plane.
+func (p *Pyramid) Tile(tile Tile, start, end unit.Frequency) [][]float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	from, to := tile.Times()
+	rows := p.levels[tile.Zoom]
+
+	search := func(row pyramidRow, t time.Time) int {
+		return row.scan.DateTime.Compare(t)
+	}
+	first, _ := slices.BinarySearchFunc(rows, from, search)
+	last, _ := slices.BinarySearchFunc(rows, to, search)
+
+	scans := make([]*power.Scan, 0, last-first)
+	for _, row := range rows[first:last] {
+		scans = append(scans, row.scan)
+	}
+
+	return tile.Pool(scans, start, end)
+}
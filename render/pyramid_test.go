@@ -0,0 +1,105 @@
+package render
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// equal compares tiles, taking NaN as equal to NaN.
+func equal(a, b [][]float64) bool {
+	for row := range a {
+		for col := range a[row] {
+			if a[row][col] != b[row][col] && !(math.IsNaN(a[row][col]) && math.IsNaN(b[row][col])) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// TestPyramid checks that the tiles pooled from the pyramid, and those merged
+// a sweep at a time, are the tiles pooled from the sweeps themselves.
+func TestPyramid(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	epoch := time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)
+
+	const start, end unit.Frequency = 88e6, 108e6
+
+	var sweeps []*power.Scan
+	for i := range 3000 {
+		sweep := &power.Scan{
+			DateTime:       epoch.Add(time.Duration(i) * 1500 * time.Millisecond),
+			StartFrequency: start,
+			EndFrequency:   end,
+			Bins:           make([]unit.Decabel, 512),
+		}
+		for bin := range sweep.Bins {
+			sweep.Bins[bin] = unit.Decabel(r.NormFloat64()*5 - 50)
+		}
+		if i%7 == 0 {
+			sweep.Bins[r.Intn(512)] = unit.Decabel(math.NaN())
+		}
+		sweeps = append(sweeps, sweep)
+	}
+
+	tests := []Tile{
+		{Zoom: MaxZoom, X: 17, Y: TileAt(MaxZoom, sweeps[1000].DateTime)},
+		{Zoom: 9, X: 300, Y: TileAt(9, sweeps[2000].DateTime)},
+		{Zoom: 4, X: 3, Y: TileAt(4, sweeps[0].DateTime)},
+		{Zoom: 0, X: 0, Y: TileAt(0, sweeps[2999].DateTime)},
+	}
+
+	pyramid := &Pyramid{}
+	merged := make([][][]float64, len(tests))
+	for i, tile := range tests {
+		merged[i] = tile.Pool(nil, start, end)
+	}
+
+	for _, sweep := range sweeps {
+		pyramid.Add(sweep)
+		for i, tile := range tests {
+			merged[i] = tile.Merge(merged[i], sweep, start, end)
+		}
+	}
+
+	for i, tile := range tests {
+		want := tile.Pool(sweeps, start, end)
+
+		if !equal(pyramid.Tile(tile, start, end), want) {
+			t.Errorf("tile %+v pooled from the pyramid differs", tile)
+		}
+
+		if !equal(merged[i], want) {
+			t.Errorf("tile %+v merged a sweep at a time differs", tile)
+		}
+	}
+}
+
+func TestPyramidTrim(t *testing.T) {
+	epoch := time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)
+
+	pyramid := &Pyramid{}
+	for i := range 100 {
+		pyramid.Add(&power.Scan{
+			DateTime:       epoch.Add(time.Duration(i) * time.Second),
+			StartFrequency: 1e6,
+			EndFrequency:   2e6,
+			Bins:           []unit.Decabel{-50},
+		})
+	}
+
+	pyramid.Trim(epoch.Add(90 * time.Second))
+
+	// the rows that end after the time are kept.
+	for zoom, want := range map[int]int{MaxZoom: 10, MaxZoom - 1: 5, MaxZoom - 4: 2} {
+		if got := len(pyramid.levels[zoom]); got != want {
+			t.Errorf("zoom %d keeps %d rows, want %d", zoom, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"image"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+const (
+	// TileSize is the width and height of a tile in pixels.
+	TileSize = 256
+
+	// MaxZoom is the deepest zoom level, where a row of a tile is a second.
+	MaxZoom = 12
+)
+
+// Tile addresses a square of the time/frequency plane, in the manner of a
+// slippy map. At zoom level z the frequency range is split into 2^z columns
+// of tiles, x counting up in frequency, while y counts tiles of TileSize rows
+// of Resolution(z) since the unix epoch, so time runs down the plane.
+type Tile struct {
+	Zoom int
+	X    int
+	Y    int
+}
+
+// Resolution returns the time covered by a row of a tile at the zoom level.
+func Resolution(zoom int) time.Duration {
+	return time.Second << (MaxZoom - zoom)
+}
+
+// TileAt returns the y of the tile covering t at the zoom level.
+func TileAt(zoom int, t time.Time) int {
+	span := Resolution(zoom) * TileSize
+	return int(t.Sub(time.Unix(0, 0)).Truncate(span) / span)
+}
+
+// Valid reports whether the tile is inside the plane.
+func (tile Tile) Valid() bool {
+	return tile.Zoom >= 0 && tile.Zoom <= MaxZoom && tile.X >= 0 && tile.X < 1<<tile.Zoom && tile.Y >= 0
+}
+
+// Times returns the time range covered by the tile.
+func (tile Tile) Times() (time.Time, time.Time) {
+	span := Resolution(tile.Zoom) * TileSize
+	from := time.Unix(0, 0).Add(span * time.Duration(tile.Y))
+
+	return from, from.Add(span)
+}
+
+// Frequencies returns the part of [start, end) covered by the tile.
+func (tile Tile) Frequencies(start, end unit.Frequency) (unit.Frequency, unit.Frequency) {
+	width := (end - start) / unit.Frequency(int(1)<<tile.Zoom)
+	lo := start + width*unit.Frequency(tile.X)
+
+	return lo, lo + width
+}
+
+// Pool max pools the scans that fall within the tile into a TileSize grid,
+// where [start, end) is the frequency range of the whole plane. Rows without
+// a sweep are NaN.
+func (tile Tile) Pool(scans []*power.Scan, start, end unit.Frequency) [][]float64 {
+	values := make([][]float64, TileSize)
+	for row := range values {
+		values[row] = make([]float64, TileSize)
+		for col := range values[row] {
+			values[row][col] = math.NaN()
+		}
+	}
+
+	for _, scan := range scans {
+		if row, ok := tile.row(scan, start, end); ok {
+			tile.pool(values[row], scan, start, end)
+		}
+	}
+
+	return values
+}
+
+// Merge returns the grid with the scan max pooled into it, as Pool would
+// have. The row of the scan is copied rather than changed, so the grid may
+// still be in use elsewhere.
+func (tile Tile) Merge(values [][]float64, scan *power.Scan, start, end unit.Frequency) [][]float64 {
+	row, ok := tile.row(scan, start, end)
+	if !ok {
+		return values
+	}
+
+	values = slices.Clone(values)
+	values[row] = slices.Clone(values[row])
+	tile.pool(values[row], scan, start, end)
+
+	return values
+}
+
+// row returns the row of the tile the scan falls in, if it falls within the
+// tile at all.
+func (tile Tile) row(scan *power.Scan, start, end unit.Frequency) (int, bool) {
+	from, to := tile.Times()
+	lo, hi := tile.Frequencies(start, end)
+
+	if scan.DateTime.Before(from) || !scan.DateTime.Before(to) {
+		return 0, false
+	}
+
+	if scan.EndFrequency <= lo || scan.StartFrequency >= hi {
+		return 0, false
+	}
+
+	return int(scan.DateTime.Sub(from) / Resolution(tile.Zoom)), true
+}
+
+// pool max pools the scan into a row of the tile.
+func (tile Tile) pool(row []float64, scan *power.Scan, start, end unit.Frequency) {
+	lo, hi := tile.Frequencies(start, end)
+
+	for col, value := range Columns(scan, TileSize, lo, hi) {
+		if value > row[col] || math.IsNaN(row[col]) {
+			row[col] = value
+		}
+	}
+}
+
+// TileImage paints pooled tile values with the colormap. Pixels without data
+// are transparent.
+func TileImage(values [][]float64, cm Colormap, lo, hi unit.Decabel) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+	Paint(img, img.Bounds(), values, cm, lo, hi)
+
+	return img
+}
@@ -0,0 +1,280 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+var trace = color.RGBA{0x4f, 0xc3, 0xf7, 0xff}
+
+// Timelapse animates sweeps as a GIF. Each frame shows the spectrum of a
+// sweep above a waterfall of the sweeps before it, with the time of the sweep
+// burned in.
+type Timelapse struct {
+	Waterfall
+
+	// Frames is the number of frames, spread evenly over the sweeps.
+	Frames int
+
+	// Delay is the time each frame is shown for.
+	Delay time.Duration
+
+	// Window is the time covered by the waterfall of each frame. When 0 it
+	// covers a quarter of the sweeps.
+	Window time.Duration
+}
+
+type TimelapseOption func(*Timelapse)
+
+// WithWaterfall applies waterfall options to the frames, for their size,
+// colormap, levels, frequency range and axes.
+func WithWaterfall(opts ...Option) TimelapseOption {
+	return func(t *Timelapse) {
+		for _, opt := range opts {
+			opt(&t.Waterfall)
+		}
+	}
+}
+
+func Frames(n int) TimelapseOption {
+	return func(t *Timelapse) {
+		t.Frames = n
+	}
+}
+
+func FrameDelay(delay time.Duration) TimelapseOption {
+	return func(t *Timelapse) {
+		t.Delay = delay
+	}
+}
+
+// Window sets the time covered by the waterfall of each frame.
+func Window(window time.Duration) TimelapseOption {
+	return func(t *Timelapse) {
+		t.Window = window
+	}
+}
+
+func NewTimelapse(opts ...TimelapseOption) *Timelapse {
+	t := &Timelapse{
+		Waterfall: *NewWaterfall(),
+		Frames:    60,
+		Delay:     100 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// palette returns the colours of the frames: the background, foreground and
+// trace, followed by samples of the colormap.
+func (t *Timelapse) palette() color.Palette {
+	palette := color.Palette{background, foreground, trace}
+	for len(palette) < 256 {
+		palette = append(palette, t.Colormap.At(float64(len(palette)-3)/float64(256-4)))
+	}
+
+	return palette
+}
+
+// scansLevels returns the levels of every bin of the scans, so that each frame
+// is coloured alike.
+func scansLevels(scans []*power.Scan) (unit.Decabel, unit.Decabel) {
+	values := make([][]float64, len(scans))
+	for i, scan := range scans {
+		values[i] = make([]float64, len(scan.Bins))
+		for j, bin := range scan.Bins {
+			values[i][j] = float64(bin)
+		}
+	}
+
+	return levels(values)
+}
+
+// Render animates the scans, which must be ordered oldest first.
+func (t *Timelapse) Render(scans []*power.Scan) (*gif.GIF, error) {
+	if len(scans) == 0 {
+		return nil, fmt.Errorf("no sweeps to animate")
+	}
+
+	if t.Frames < 1 {
+		return nil, fmt.Errorf("a timelapse needs at least one frame")
+	}
+
+	start, end := t.frequencyRange(scans)
+	if end <= start {
+		return nil, fmt.Errorf("empty frequency range")
+	}
+
+	lo, hi := t.Min, t.Max
+	if t.AutoLevels || hi <= lo {
+		lo, hi = scansLevels(scans)
+	}
+
+	window := t.Window
+	if window <= 0 {
+		window = max(time.Second, scans[len(scans)-1].DateTime.Sub(scans[0].DateTime)/4)
+	}
+
+	frames := min(t.Frames, len(scans))
+	anim := &gif.GIF{}
+	palette := t.palette()
+	indices := map[color.RGBA]uint8{}
+
+	for i := range frames {
+		current := (i+1)*len(scans)/frames - 1
+		img := t.frame(scans[:current+1], window, start, end, lo, hi)
+
+		anim.Image = append(anim.Image, quantize(img, palette, indices))
+		anim.Delay = append(anim.Delay, int(t.Delay/(10*time.Millisecond)))
+	}
+
+	return anim, nil
+}
+
+// quantize maps the colours of img onto the palette, remembering the index
+// of each colour it has seen.
+func quantize(img *image.RGBA, palette color.Palette, indices map[color.RGBA]uint8) *image.Paletted {
+	dst := image.NewPaletted(img.Bounds(), palette)
+
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			index, ok := indices[c]
+			if !ok {
+				index = uint8(palette.Index(c))
+				indices[c] = index
+			}
+			dst.SetColorIndex(x, y, index)
+		}
+	}
+
+	return dst
+}
+
+// frame draws the last of the scans, with the scans within the window before
+// it.
+func (t *Timelapse) frame(scans []*power.Scan, window time.Duration, start, end unit.Frequency, lo, hi unit.Decabel) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, t.Width, t.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	current := scans[len(scans)-1]
+	scale := labelScale(t.Width)
+
+	header := textHeight(scale) + 4*scale
+	bottom := 0
+	if t.Axes {
+		bottom = textHeight(scale) + 4*scale
+	}
+
+	height := t.Height - header - bottom
+	spectrum := image.Rect(0, header, t.Width, header+height/3)
+	plot := image.Rect(0, spectrum.Max.Y+scale, t.Width, t.Height-bottom)
+	if spectrum.Dy() <= 0 || plot.Dy() <= 0 || plot.Dx() <= 0 {
+		return img
+	}
+
+	drawText(img, image.Pt(2*scale, 2*scale), current.DateTime.UTC().Format("2006-01-02 15:04:05 UTC"), foreground, scale)
+
+	label := fmt.Sprintf("%.0f to %.0f dB", float64(lo), float64(hi))
+	drawText(img, image.Pt(t.Width-2*scale-textWidth(label, scale), 2*scale), label, foreground, scale)
+
+	drawSpectrum(img, spectrum, Columns(current, spectrum.Dx(), start, end), lo, hi, scale)
+
+	// only the scans within the window before the current one are drawn.
+	first := sort.Search(len(scans), func(i int) bool {
+		return current.DateTime.Sub(scans[i].DateTime) < window
+	})
+	Paint(img, plot, scroll(scans[first:], window, plot.Dy(), plot.Dx(), start, end), t.Colormap, lo, hi)
+
+	if t.Axes {
+		drawFrequencyAxis(img, plot, start, end, scale)
+	}
+
+	return img
+}
+
+// drawSpectrum draws the values as a trace across the rectangle.
+func drawSpectrum(img *image.RGBA, rect image.Rectangle, values []float64, lo, hi unit.Decabel, scale int) {
+	y := func(value float64) int {
+		frac := (value - float64(lo)) / float64(hi-lo)
+		frac = max(0, min(1, frac))
+		return rect.Max.Y - 1 - int(frac*float64(rect.Dy()-1))
+	}
+
+	src := image.NewUniform(trace)
+	prev := -1
+	for col, value := range values {
+		if math.IsNaN(value) {
+			prev = -1
+			continue
+		}
+
+		cur := y(value)
+		top, bottom := cur, cur
+		if prev >= 0 {
+			top, bottom = min(prev, cur), max(prev, cur)
+		}
+		prev = cur
+
+		x := rect.Min.X + col
+		draw.Draw(img, image.Rect(x, top, x+1, bottom+scale), src, image.Point{}, draw.Src)
+	}
+}
+
+// scroll pools the scans into a rows by columns grid by time, the newest scan
+// in the first row and the rows covering the window before it. Each scan
+// fills the rows down to the next older scan.
+func scroll(scans []*power.Scan, window time.Duration, rows, columns int, start, end unit.Frequency) [][]float64 {
+	values := make([][]float64, rows)
+	for row := range values {
+		values[row] = make([]float64, columns)
+		for col := range values[row] {
+			values[row][col] = math.NaN()
+		}
+	}
+
+	if len(scans) == 0 {
+		return values
+	}
+
+	newest := scans[len(scans)-1].DateTime
+	row := func(scan *power.Scan) int {
+		return int(float64(newest.Sub(scan.DateTime)) / float64(window) * float64(rows))
+	}
+
+	for i, scan := range scans {
+		first := row(scan)
+		last := first + 1
+		if i > 0 {
+			last = row(scans[i-1])
+		} else if len(scans) > 1 {
+			// the oldest scan is as tall as the one after it.
+			last = 2*first - row(scans[1])
+		}
+		last = max(first+1, min(last, rows))
+
+		pooled := Columns(scan, columns, start, end)
+		for r := first; r < last; r++ {
+			for col, value := range pooled {
+				if !(value <= values[r][col]) {
+					values[r][col] = value
+				}
+			}
+		}
+	}
+
+	return values
+}
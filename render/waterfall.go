@@ -0,0 +1,350 @@
+// Package render draws sweeps as images.
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+var (
+	background = color.RGBA{0x28, 0x28, 0x28, 0xff}
+	foreground = color.RGBA{0xf3, 0xf3, 0xf3, 0xff}
+)
+
+// Waterfall renders sweeps as a time/frequency image. Each row is a sweep,
+// the newest at the top, and each column a frequency. When there are more
+// sweeps or bins than pixels, each pixel holds the peak of those it covers.
+type Waterfall struct {
+	Width  int
+	Height int
+
+	Colormap Colormap
+
+	// Min and Max are the levels mapped to either end of the colormap. They
+	// are ignored when AutoLevels is set.
+	Min        unit.Decabel
+	Max        unit.Decabel
+	AutoLevels bool
+
+	// Start and End limit the frequencies drawn. When End is 0 the range
+	// covers every sweep.
+	Start unit.Frequency
+	End   unit.Frequency
+
+	// Axes reserves a margin for frequency and time axes.
+	Axes bool
+
+	// TimeFormat is the layout of the labels of the time axis. When empty it
+	// is the time, with the date for sweeps spanning more than a day.
+	TimeFormat string
+}
+
+type Option func(*Waterfall)
+
+// Size sets the size of the image in pixels, including any axes.
+func Size(width, height int) Option {
+	return func(w *Waterfall) {
+		w.Width = width
+		w.Height = height
+	}
+}
+
+func WithColormap(cm Colormap) Option {
+	return func(w *Waterfall) {
+		w.Colormap = cm
+	}
+}
+
+// Levels sets a fixed dB range and disables auto levels.
+func Levels(min, max unit.Decabel) Option {
+	return func(w *Waterfall) {
+		w.Min = min
+		w.Max = max
+		w.AutoLevels = false
+	}
+}
+
+// AutoLevels picks the dB range from the data being drawn.
+func AutoLevels() Option {
+	return func(w *Waterfall) {
+		w.AutoLevels = true
+	}
+}
+
+// FrequencyRange limits the frequencies drawn.
+func FrequencyRange(start, end unit.Frequency) Option {
+	return func(w *Waterfall) {
+		w.Start = start
+		w.End = end
+	}
+}
+
+// WithAxes draws frequency and time axes.
+func WithAxes() Option {
+	return func(w *Waterfall) {
+		w.Axes = true
+	}
+}
+
+// TimeFormat sets the layout of the labels of the time axis.
+func TimeFormat(layout string) Option {
+	return func(w *Waterfall) {
+		w.TimeFormat = layout
+	}
+}
+
+func NewWaterfall(opts ...Option) *Waterfall {
+	w := &Waterfall{
+		Width:      800,
+		Height:     600,
+		Colormap:   Viridis,
+		AutoLevels: true,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// frequencyRange returns the frequencies to draw for the scans.
+func (w *Waterfall) frequencyRange(scans []*power.Scan) (unit.Frequency, unit.Frequency) {
+	if w.End > w.Start {
+		return w.Start, w.End
+	}
+
+	start, end := unit.Frequency(math.Inf(1)), unit.Frequency(math.Inf(-1))
+	for _, scan := range scans {
+		start = min(start, scan.StartFrequency)
+		end = max(end, scan.EndFrequency)
+	}
+
+	if len(scans) == 0 {
+		return 0, 0
+	}
+
+	return start, end
+}
+
+// Pool returns the peak of the bins of the scan overlapping [lo, hi), or NaN
+// when there are none.
+func Pool(scan *power.Scan, lo, hi unit.Frequency) float64 {
+	width := scan.BinWidth()
+	if width <= 0 {
+		return math.NaN()
+	}
+
+	first := int(math.Floor(float64((lo - scan.StartFrequency) / width)))
+	last := int(math.Ceil(float64((hi - scan.StartFrequency) / width)))
+
+	first = max(0, first)
+	last = min(len(scan.Bins), last)
+
+	peak := math.NaN()
+	for _, bin := range scan.Bins[min(first, last):last] {
+		if value := float64(bin); !(value <= peak) {
+			peak = value
+		}
+	}
+
+	return peak
+}
+
+// Columns pools the scan into columns equal slices of [start, end).
+func Columns(scan *power.Scan, columns int, start, end unit.Frequency) []float64 {
+	values := make([]float64, columns)
+	step := (end - start) / unit.Frequency(columns)
+
+	for col := range values {
+		lo := start + step*unit.Frequency(col)
+		values[col] = Pool(scan, lo, lo+step)
+	}
+
+	return values
+}
+
+// grid pools the scans into a rows by columns grid, the newest scan in the
+// first row.
+func grid(scans []*power.Scan, rows, columns int, start, end unit.Frequency) [][]float64 {
+	values := make([][]float64, rows)
+	for row := range values {
+		values[row] = make([]float64, columns)
+		for col := range values[row] {
+			values[row][col] = math.NaN()
+		}
+	}
+
+	n := len(scans)
+	if n == 0 {
+		return values
+	}
+
+	for i, scan := range scans {
+		pooled := Columns(scan, columns, start, end)
+
+		// rows covered by scan i, counted from the oldest.
+		first := i * rows / n
+		last := max(first+1, (i+1)*rows/n)
+
+		for r := first; r < last; r++ {
+			row := values[rows-1-r]
+			for col, value := range pooled {
+				if !(value <= row[col]) {
+					row[col] = value
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+// levels returns the 1st and 99th percentile of the finite values, which make
+// a range that is not dominated by a handful of outliers.
+func levels(values [][]float64) (unit.Decabel, unit.Decabel) {
+	finite := []float64{}
+	for _, row := range values {
+		for _, value := range row {
+			if !math.IsNaN(value) && !math.IsInf(value, 0) {
+				finite = append(finite, value)
+			}
+		}
+	}
+
+	if len(finite) == 0 {
+		return -100, 0
+	}
+
+	slices.Sort(finite)
+	lo := finite[len(finite)/100]
+	hi := finite[len(finite)-1-len(finite)/100]
+
+	if hi <= lo {
+		lo, hi = lo-1, hi+1
+	}
+
+	return unit.Decabel(lo), unit.Decabel(hi)
+}
+
+// Paint maps the values onto the rectangle of the image with the colormap.
+// NaN values are left untouched.
+func Paint(img *image.RGBA, rect image.Rectangle, values [][]float64, cm Colormap, lo, hi unit.Decabel) {
+	span := float64(hi - lo)
+
+	for row, line := range values {
+		for col, value := range line {
+			if math.IsNaN(value) {
+				continue
+			}
+
+			img.SetRGBA(rect.Min.X+col, rect.Min.Y+row, cm.At((value-float64(lo))/span))
+		}
+	}
+}
+
+// margins returns the space reserved for the time axis on the left and the
+// frequency axis at the bottom.
+func (w *Waterfall) margins(scale int) (int, int) {
+	if !w.Axes {
+		return 0, 0
+	}
+
+	return textWidth("00-00 00:00", scale) + 4*scale, textHeight(scale) + 4*scale
+}
+
+// labelScale returns the scale of the axis labels for the image size.
+func labelScale(width int) int {
+	return max(1, width/800)
+}
+
+// Render draws the scans, which must be ordered oldest first.
+func (w *Waterfall) Render(scans []*power.Scan) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w.Width, w.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	scale := labelScale(w.Width)
+	left, bottom := w.margins(scale)
+	plot := image.Rect(left, 0, w.Width, w.Height-bottom)
+	if plot.Dx() <= 0 || plot.Dy() <= 0 {
+		return img
+	}
+
+	start, end := w.frequencyRange(scans)
+	if end <= start {
+		return img
+	}
+
+	values := grid(scans, plot.Dy(), plot.Dx(), start, end)
+
+	lo, hi := w.Min, w.Max
+	if w.AutoLevels || hi <= lo {
+		lo, hi = levels(values)
+	}
+
+	Paint(img, plot, values, w.Colormap, lo, hi)
+
+	if w.Axes {
+		drawFrequencyAxis(img, plot, start, end, scale)
+		drawTimeAxis(img, plot, scans, w.TimeFormat, scale)
+	}
+
+	return img
+}
+
+// drawFrequencyAxis labels the frequencies below the plot.
+func drawFrequencyAxis(img *image.RGBA, plot image.Rectangle, start, end unit.Frequency, scale int) {
+	const ticks = 5
+	y := plot.Max.Y
+
+	draw.Draw(img, image.Rect(plot.Min.X, y, plot.Max.X, y+scale), image.NewUniform(foreground), image.Point{}, draw.Src)
+
+	for i := range ticks {
+		frac := float64(i) / float64(ticks-1)
+		x := plot.Min.X + int(frac*float64(plot.Dx()-scale))
+		draw.Draw(img, image.Rect(x, y, x+scale, y+2*scale), image.NewUniform(foreground), image.Point{}, draw.Src)
+
+		label := (start + (end-start)*unit.Frequency(frac)).String()
+		lx := x - int(frac*float64(textWidth(label, scale)))
+		drawText(img, image.Pt(lx, y+3*scale), label, foreground, scale)
+	}
+}
+
+// drawTimeAxis labels the time of the sweeps left of the plot, in the
+// layout, or one picked for their span when it is empty.
+func drawTimeAxis(img *image.RGBA, plot image.Rectangle, scans []*power.Scan, layout string, scale int) {
+	if len(scans) == 0 {
+		return
+	}
+
+	if layout == "" {
+		layout = time.TimeOnly
+		if scans[len(scans)-1].DateTime.Sub(scans[0].DateTime) > 24*time.Hour {
+			layout = "01-02 15:04"
+		}
+	}
+
+	x := plot.Min.X - scale
+	draw.Draw(img, image.Rect(x, plot.Min.Y, x+scale, plot.Max.Y), image.NewUniform(foreground), image.Point{}, draw.Src)
+
+	ticks := max(2, min(len(scans), plot.Dy()/(8*textHeight(scale))))
+	for i := range ticks {
+		frac := float64(i) / float64(ticks-1)
+		y := plot.Min.Y + int(frac*float64(plot.Dy()-scale))
+
+		// the newest sweep is at the top.
+		scan := scans[len(scans)-1-int(frac*float64(len(scans)-1))]
+		label := scan.DateTime.Format(layout)
+
+		ly := y - int(frac*float64(textHeight(scale)))
+		draw.Draw(img, image.Rect(x-2*scale, y, x, y+scale), image.NewUniform(foreground), image.Point{}, draw.Src)
+		drawText(img, image.Pt(x-3*scale-textWidth(label, scale), ly), label, foreground, scale)
+	}
+}
@@ -0,0 +1,96 @@
+// Package band measures the power of named frequency bands in sweeps.
+package band
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// bandName limits band names to what can be used as a label or in a path.
+var bandName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Band is a named range of frequencies, [Start, End).
+type Band struct {
+	Name  string         `json:"name"`
+	Start unit.Frequency `json:"start"`
+	End   unit.Frequency `json:"end"`
+}
+
+// Parse reads a band given as `name=start:end`, with the frequencies in Hz.
+func Parse(value string) (Band, error) {
+	name, rest, ok := strings.Cut(value, "=")
+	if !ok || !bandName.MatchString(name) {
+		return Band{}, fmt.Errorf("invalid band %q, expected name=start:end with a name of letters, digits, _ and -", value)
+	}
+
+	start, end, ok := strings.Cut(rest, ":")
+	if !ok {
+		return Band{}, fmt.Errorf("invalid band %q, expected name=start:end", value)
+	}
+
+	band := Band{Name: name}
+
+	if err := band.Start.UnmarshalText([]byte(start)); err != nil {
+		return Band{}, fmt.Errorf("band %s: %w", name, err)
+	}
+
+	if err := band.End.UnmarshalText([]byte(end)); err != nil {
+		return Band{}, fmt.Errorf("band %s: %w", name, err)
+	}
+
+	if band.End <= band.Start {
+		return Band{}, fmt.Errorf("band %s ends before it starts", name)
+	}
+
+	return band, nil
+}
+
+// Measurement is the power in a band during one sweep.
+type Measurement struct {
+	// Power is the sum of the power of the bins in the band, and Mean their
+	// mean.
+	Power unit.Decabel `json:"power"`
+	Mean  unit.Decabel `json:"mean"`
+	// PeakPower is the power of the strongest bin, at the centre frequency
+	// PeakFrequency.
+	PeakPower     unit.Decabel   `json:"peak_power"`
+	PeakFrequency unit.Frequency `json:"peak_frequency"`
+	// Bins is the number of bins that overlap the band.
+	Bins int `json:"bins"`
+}
+
+// Measure measures the band in the sweep. It reports false when the sweep
+// does not cover any of the band.
+func (band Band) Measure(scan *power.Scan) (Measurement, bool) {
+	slice := scan.Slice(band.Start, band.End)
+
+	m := Measurement{PeakPower: unit.Decabel(math.Inf(-1))}
+	linear := 0.0
+
+	for i, bin := range slice.Bins {
+		if math.IsNaN(float64(bin)) {
+			continue
+		}
+
+		m.Bins++
+		linear += math.Pow(10, float64(bin)/10)
+
+		if bin > m.PeakPower {
+			m.PeakPower = bin
+			m.PeakFrequency = slice.Frequency(i) + slice.BinWidth()/2
+		}
+	}
+
+	if m.Bins == 0 {
+		return Measurement{}, false
+	}
+
+	m.Power = unit.Decabel(10 * math.Log10(linear))
+	m.Mean = unit.Decabel(10 * math.Log10(linear/float64(m.Bins)))
+	return m, true
+}
@@ -0,0 +1,100 @@
+package band
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Sample is the measurement of a band in the sweep at Time.
+type Sample struct {
+	Time time.Time `json:"time"`
+	Measurement
+}
+
+// Series measures the band in each of the sweeps, skipping those that do not
+// cover any of it.
+func (band Band) Series(scans []*power.Scan) []Sample {
+	samples := []Sample{}
+
+	for _, scan := range scans {
+		if m, ok := band.Measure(scan); ok {
+			samples = append(samples, Sample{Time: scan.DateTime, Measurement: m})
+		}
+	}
+
+	return samples
+}
+
+// Average averages the samples of each interval into one, dated by the start
+// of the interval. The power is averaged in linear power, the peak is the
+// strongest of the interval and the bins the most of any of its samples.
+func Average(samples []Sample, interval time.Duration) []Sample {
+	if interval <= 0 {
+		return samples
+	}
+
+	averaged := []Sample{}
+	linear, mean, n := 0.0, 0.0, 0
+
+	flush := func() {
+		if n > 0 {
+			last := &averaged[len(averaged)-1]
+			last.Power = unit.Decabel(10 * math.Log10(linear/float64(n)))
+			last.Mean = unit.Decabel(10 * math.Log10(mean/float64(n)))
+		}
+		linear, mean, n = 0, 0, 0
+	}
+
+	for _, s := range samples {
+		start := s.Time.Truncate(interval)
+
+		if len(averaged) == 0 || !averaged[len(averaged)-1].Time.Equal(start) {
+			flush()
+			averaged = append(averaged, Sample{Time: start, Measurement: s.Measurement})
+		}
+
+		last := &averaged[len(averaged)-1]
+		if s.PeakPower > last.PeakPower {
+			last.PeakPower, last.PeakFrequency = s.PeakPower, s.PeakFrequency
+		}
+		last.Bins = max(last.Bins, s.Bins)
+
+		linear += math.Pow(10, float64(s.Power)/10)
+		mean += math.Pow(10, float64(s.Mean)/10)
+		n++
+	}
+	flush()
+
+	return averaged
+}
+
+// WriteCSV writes a row per sample: its time, the integrated and mean power
+// in dB, the peak power and frequency and the number of bins.
+func WriteCSV(w io.Writer, samples []Sample) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "power_db", "mean_db", "peak_power_db", "peak_frequency_hz", "bins"})
+
+	float := func(value float64, precision int) string {
+		return strconv.FormatFloat(value, 'f', precision, 64)
+	}
+
+	for _, s := range samples {
+		cw.Write([]string{
+			s.Time.UTC().Format(time.RFC3339Nano),
+			float(float64(s.Power), 2),
+			float(float64(s.Mean), 2),
+			float(float64(s.PeakPower), 2),
+			float(float64(s.PeakFrequency), 0),
+			strconv.Itoa(s.Bins),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
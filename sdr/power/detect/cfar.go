@@ -0,0 +1,271 @@
+// Package detect finds signals in sweeps with a constant false alarm rate
+// (CFAR) detector, which compares each bin with the noise estimated from the
+// bins around it.
+package detect
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Method is how the noise is estimated from the training cells.
+type Method string
+
+const (
+	// CellAveraging takes the mean of the training cells. It is accurate in
+	// uniform noise, but nearby signals raise the estimate and hide each
+	// other.
+	CellAveraging Method = "ca"
+	// OrderedStatistic takes a rank of the training cells, which tolerates a
+	// few strong signals among them.
+	OrderedStatistic Method = "os"
+)
+
+// Detection is a run of adjacent bins above the threshold.
+type Detection struct {
+	Time time.Time `json:"time"`
+
+	// Frequency is the centre of the run and Bandwidth its width.
+	Frequency unit.Frequency `json:"frequency"`
+	Bandwidth unit.Frequency `json:"bandwidth"`
+
+	// Peak is the power of the strongest bin, at the centre frequency
+	// PeakFrequency.
+	Peak          unit.Decabel   `json:"peak"`
+	PeakFrequency unit.Frequency `json:"peak_frequency"`
+
+	// Noise is the noise estimated at the strongest bin, and SNR how far the
+	// peak is above it.
+	Noise unit.Decabel `json:"noise"`
+	SNR   unit.Decabel `json:"snr"`
+}
+
+type Option func(*Detector)
+
+func WithMethod(method Method) Option {
+	return func(d *Detector) {
+		d.Method = method
+	}
+}
+
+// Guard sets the number of cells on each side of the cell under test that are
+// left out of the noise estimate, so that a signal does not raise its own
+// threshold.
+func Guard(cells int) Option {
+	return func(d *Detector) {
+		d.Guard = cells
+	}
+}
+
+// Training sets the number of cells on each side, beyond the guard cells,
+// that the noise is estimated from.
+func Training(cells int) Option {
+	return func(d *Detector) {
+		d.Training = cells
+	}
+}
+
+// FalseAlarmRate sets the probability that a bin of noise is detected.
+func FalseAlarmRate(pfa float64) Option {
+	return func(d *Detector) {
+		d.FalseAlarmRate = pfa
+	}
+}
+
+// Rank sets the rank of the ordered statistic as a fraction of the training
+// cells, 0.75 by default.
+func Rank(rank float64) Option {
+	return func(d *Detector) {
+		d.Rank = rank
+	}
+}
+
+// Detector runs a CFAR detector over sweeps.
+type Detector struct {
+	Method         Method
+	Guard          int
+	Training       int
+	FalseAlarmRate float64
+	Rank           float64
+
+	// factors caches the threshold factor for each number of training
+	// cells, which is smaller near the edges of a sweep.
+	factors map[int]float64
+}
+
+func New(opts ...Option) (*Detector, error) {
+	d := &Detector{
+		Method:         CellAveraging,
+		Guard:          2,
+		Training:       8,
+		FalseAlarmRate: 1e-6,
+		Rank:           0.75,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	switch {
+	case d.Method != CellAveraging && d.Method != OrderedStatistic:
+		return nil, fmt.Errorf("unknown CFAR method %q, expected ca or os", d.Method)
+	case d.Guard < 0:
+		return nil, fmt.Errorf("guard cells cannot be negative")
+	case d.Training < 1:
+		return nil, fmt.Errorf("at least one training cell is needed")
+	case d.FalseAlarmRate <= 0 || d.FalseAlarmRate >= 1:
+		return nil, fmt.Errorf("the false alarm rate must be between 0 and 1")
+	case d.Rank <= 0 || d.Rank > 1:
+		return nil, fmt.Errorf("the rank must be above 0 and at most 1")
+	}
+
+	d.factors = map[int]float64{}
+	for n := 1; n <= 2*d.Training; n++ {
+		d.factors[n] = d.factor(n)
+	}
+
+	return d, nil
+}
+
+// rank returns the index of the ordered statistic among n cells.
+func (d *Detector) rank(n int) int {
+	return max(0, min(n-1, int(math.Round(d.Rank*float64(n)))-1))
+}
+
+// factor returns the multiple of the noise estimate from n training cells
+// that noise exceeds with the false alarm rate. The bins are taken to be the
+// power of complex Gaussian noise, which is exponentially distributed.
+func (d *Detector) factor(n int) float64 {
+	pfa := d.FalseAlarmRate
+
+	if d.Method == CellAveraging {
+		return float64(n) * (math.Pow(pfa, -1/float64(n)) - 1)
+	}
+
+	// the false alarm rate of the k-th of n ordered cells falls as the
+	// factor grows, so it is found by bisection.
+	k := d.rank(n) + 1
+	rate := func(alpha float64) float64 {
+		p := 1.0
+		for i := range k {
+			p *= float64(n-i) / (float64(n-i) + alpha)
+		}
+		return p
+	}
+
+	lo, hi := 0.0, 1.0
+	for rate(hi) > pfa {
+		hi *= 2
+	}
+
+	for range 100 {
+		mid := (lo + hi) / 2
+		if rate(mid) > pfa {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return hi
+}
+
+// estimate returns the noise around the cell from the training cells on
+// either side of it, and the number of training cells, which is 0 when there
+// are none. training is reused between cells.
+func (d *Detector) estimate(linear []float64, cell int, training []float64) (float64, int) {
+	training = training[:0]
+
+	for offset := d.Guard + 1; offset <= d.Guard+d.Training; offset++ {
+		for _, i := range []int{cell - offset, cell + offset} {
+			if i >= 0 && i < len(linear) && !math.IsNaN(linear[i]) {
+				training = append(training, linear[i])
+			}
+		}
+	}
+
+	n := len(training)
+	if n == 0 {
+		return 0, 0
+	}
+
+	var noise float64
+	if d.Method == CellAveraging {
+		for _, value := range training {
+			noise += value
+		}
+		noise /= float64(n)
+	} else {
+		slices.Sort(training)
+		noise = training[d.rank(n)]
+	}
+
+	return noise, n
+}
+
+// Detect returns the signals in the sweep, ordered by frequency.
+func (d *Detector) Detect(scan *power.Scan) []Detection {
+	n := len(scan.Bins)
+	width := scan.BinWidth()
+
+	linear := make([]float64, n)
+	for i, bin := range scan.Bins {
+		linear[i] = math.Pow(10, float64(bin)/10)
+	}
+
+	// noise holds the estimate of each detected bin, NaN for the others.
+	noise := make([]float64, n)
+	training := make([]float64, 0, 2*d.Training)
+
+	for i := range linear {
+		noise[i] = math.NaN()
+		if math.IsNaN(linear[i]) {
+			continue
+		}
+
+		estimate, cells := d.estimate(linear, i, training)
+		if cells > 0 && linear[i] > d.factors[cells]*estimate {
+			noise[i] = estimate
+		}
+	}
+
+	detections := []Detection{}
+
+	for first := 0; first < n; first++ {
+		if math.IsNaN(noise[first]) {
+			continue
+		}
+
+		last := first
+		peak := first
+		for last+1 < n && !math.IsNaN(noise[last+1]) {
+			last++
+			if scan.Bins[last] > scan.Bins[peak] {
+				peak = last
+			}
+		}
+
+		lower := scan.Frequency(first)
+		upper := scan.Frequency(last + 1)
+		floor := unit.Decabel(10 * math.Log10(noise[peak]))
+
+		detections = append(detections, Detection{
+			Time:          scan.DateTime,
+			Frequency:     (lower + upper) / 2,
+			Bandwidth:     upper - lower,
+			Peak:          scan.Bins[peak],
+			PeakFrequency: scan.Frequency(peak) + width/2,
+			Noise:         floor,
+			SNR:           scan.Bins[peak] - floor,
+		})
+
+		first = last
+	}
+
+	return detections
+}
@@ -0,0 +1,130 @@
+package detect
+
+import (
+	"math"
+	"testing"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+func TestFactor(t *testing.T) {
+	tests := []struct {
+		method Method
+		n      int
+		pfa    float64
+	}{
+		{CellAveraging, 1, 1e-3},
+		{CellAveraging, 16, 1e-6},
+		{CellAveraging, 32, 1e-2},
+		{OrderedStatistic, 1, 1e-3},
+		{OrderedStatistic, 16, 1e-6},
+		{OrderedStatistic, 32, 1e-2},
+	}
+
+	for _, test := range tests {
+		d, err := New(WithMethod(test.method), FalseAlarmRate(test.pfa))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		alpha := d.factor(test.n)
+
+		// the false alarm rate of the factor, for exponential noise.
+		rate := math.Pow(1+alpha/float64(test.n), -float64(test.n))
+		if test.method == OrderedStatistic {
+			rate = 1
+			for i := range d.rank(test.n) + 1 {
+				rate *= float64(test.n-i) / (float64(test.n-i) + alpha)
+			}
+		}
+
+		if math.Abs(rate-test.pfa)/test.pfa > 1e-6 {
+			t.Errorf("%s factor(%d) = %g, a false alarm rate of %g, want %g", test.method, test.n, alpha, rate, test.pfa)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	// sixteen bins of 1 kHz from 100 kHz.
+	scan := func(bins map[int]unit.Decabel) *power.Scan {
+		s := &power.Scan{StartFrequency: 100e3, EndFrequency: 116e3, Bins: make([]unit.Decabel, 16)}
+		for i := range s.Bins {
+			s.Bins[i] = -50
+		}
+		for i, bin := range bins {
+			s.Bins[i] = bin
+		}
+		return s
+	}
+
+	nan := unit.Decabel(math.NaN())
+
+	tests := []struct {
+		name   string
+		method Method
+		bins   map[int]unit.Decabel
+		want   []Detection
+	}{
+		{
+			name:   "flat noise",
+			method: CellAveraging,
+		},
+		{
+			name:   "a bin",
+			method: CellAveraging,
+			bins:   map[int]unit.Decabel{7: 0},
+			want:   []Detection{{Frequency: 107.5e3, Bandwidth: 1e3, Peak: 0, PeakFrequency: 107.5e3, Noise: -50, SNR: 50}},
+		},
+		{
+			name:   "adjacent bins are one detection",
+			method: CellAveraging,
+			bins:   map[int]unit.Decabel{7: -10, 8: 0},
+			want:   []Detection{{Frequency: 108e3, Bandwidth: 2e3, Peak: 0, PeakFrequency: 108.5e3, Noise: -50, SNR: 50}},
+		},
+		{
+			name:   "an edge bin",
+			method: OrderedStatistic,
+			bins:   map[int]unit.Decabel{0: 0},
+			want:   []Detection{{Frequency: 100.5e3, Bandwidth: 1e3, Peak: 0, PeakFrequency: 100.5e3, Noise: -50, SNR: 50}},
+		},
+		{
+			name:   "bins without a value",
+			method: OrderedStatistic,
+			bins:   map[int]unit.Decabel{3: nan, 7: 0, 12: nan},
+			want:   []Detection{{Frequency: 107.5e3, Bandwidth: 1e3, Peak: 0, PeakFrequency: 107.5e3, Noise: -50, SNR: 50}},
+		},
+		{
+			name:   "a weak bin",
+			method: CellAveraging,
+			bins:   map[int]unit.Decabel{7: -45},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := New(WithMethod(test.method), Guard(1), Training(4))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := d.Detect(scan(test.bins))
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d detections, want %d: %+v", len(got), len(test.want), got)
+			}
+
+			for i, want := range test.want {
+				got := got[i]
+				if got.Frequency != want.Frequency || got.Bandwidth != want.Bandwidth || got.PeakFrequency != want.PeakFrequency {
+					t.Errorf("detection %d at %v, %v wide, peaking at %v, want %v, %v wide, peaking at %v",
+						i, got.Frequency, got.Bandwidth, got.PeakFrequency, want.Frequency, want.Bandwidth, want.PeakFrequency)
+				}
+
+				if math.Abs(float64(got.Peak-want.Peak)) > 1e-9 || math.Abs(float64(got.Noise-want.Noise)) > 1e-9 || math.Abs(float64(got.SNR-want.SNR)) > 1e-9 {
+					t.Errorf("detection %d of %v over %v, %v SNR, want %v over %v, %v SNR",
+						i, got.Peak, got.Noise, got.SNR, want.Peak, want.Noise, want.SNR)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package floor estimates the noise floor of each bin from the recent
+// sweeps, so that the power of a bin can be given relative to its own floor
+// rather than to the uncalibrated full scale of rtl_power.
+package floor
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+type Option func(*Estimator)
+
+// Window sets the time before the newest sweep that the floor is estimated
+// over, 10 minutes by default.
+func Window(window time.Duration) Option {
+	return func(e *Estimator) {
+		e.Window = window
+	}
+}
+
+// Percentile sets the percentile of each bin taken as its floor, between 0
+// and 1. The default, 0.5, is the median. A lower percentile keeps the floor
+// down in bins that are busy for much of the window.
+func Percentile(percentile float64) Option {
+	return func(e *Estimator) {
+		e.Percentile = percentile
+	}
+}
+
+// Estimator tracks a running percentile of each bin over a window of sweeps,
+// in a histogram per bin that the sweeps are added to and removed from as
+// they enter and leave the window. It is reset when the sweeps change
+// frequency range or number of bins.
+type Estimator struct {
+	Window     time.Duration
+	Percentile float64
+
+	mu    sync.RWMutex
+	scans []*power.Scan
+	floor *power.Scan
+	bins  []histogram
+}
+
+func New(opts ...Option) *Estimator {
+	e := &Estimator{
+		Window:     10 * time.Minute,
+		Percentile: 0.5,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.Percentile = max(0, min(1, e.Percentile))
+
+	return e
+}
+
+// Push adds a completed sweep and updates the floor. The sweep is retained,
+// so it must not be changed afterwards.
+func (e *Estimator) Push(scan *power.Scan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.scans) > 0 && !e.scans[0].SameLayout(scan) {
+		e.scans = nil
+	}
+
+	if len(e.scans) == 0 {
+		e.bins = make([]histogram, len(scan.Bins))
+	}
+
+	e.scans = append(e.scans, scan)
+	e.count(scan, (*histogram).add)
+
+	cutoff := scan.DateTime.Add(-e.Window)
+	first := sort.Search(len(e.scans), func(i int) bool {
+		return e.scans[i].DateTime.After(cutoff)
+	})
+	if first > 0 {
+		for _, expired := range e.scans[:first] {
+			e.count(expired, (*histogram).remove)
+		}
+		e.scans = append(e.scans[:0:0], e.scans[first:]...)
+	}
+
+	floor := *scan
+	floor.Bins = make([]unit.Decabel, len(scan.Bins))
+
+	for i := range floor.Bins {
+		floor.Bins[i] = unit.Decabel(e.bins[i].percentile(e.Percentile))
+	}
+
+	e.floor = &floor
+}
+
+// count adds or removes the bins of a sweep to their histograms, skipping
+// those that are not finite.
+func (e *Estimator) count(scan *power.Scan, update func(*histogram, int)) {
+	for i, bin := range scan.Bins {
+		if value := float64(bin); !math.IsNaN(value) && !math.IsInf(value, 0) {
+			update(&e.bins[i], bucket(value))
+		}
+	}
+}
+
+// Sweeps returns the number of sweeps the floor is estimated from.
+func (e *Estimator) Sweeps() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return len(e.scans)
+}
+
+// Floor returns the floor of each bin, dated by the newest sweep, or nil
+// before the first sweep.
+func (e *Estimator) Floor() *power.Scan {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.floor
+}
+
+// SNR returns the scan with each bin given relative to its floor. Bins of a
+// scan whose layout differs from the current floor are NaN.
+func (e *Estimator) SNR(scan *power.Scan) *power.Scan {
+	floor := e.Floor()
+
+	snr := *scan
+	snr.Bins = make([]unit.Decabel, len(scan.Bins))
+
+	for i, bin := range scan.Bins {
+		if floor == nil || !floor.SameLayout(scan) {
+			snr.Bins[i] = unit.Decabel(math.NaN())
+		} else {
+			snr.Bins[i] = bin - floor.Bins[i]
+		}
+	}
+
+	return &snr
+}
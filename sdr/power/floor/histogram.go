@@ -0,0 +1,88 @@
+package floor
+
+import "math"
+
+const (
+	// resolution is the width in dB of the buckets of a histogram, and so the
+	// precision of the floor.
+	resolution = 0.05
+
+	// limit clamps the values counted, so that a stray value cannot stretch a
+	// histogram over an unbounded number of buckets.
+	limit = 300
+)
+
+// bucket returns the bucket of a value in dB.
+func bucket(value float64) int {
+	return int(math.Floor(max(-limit, min(limit, value)) / resolution))
+}
+
+// histogram counts the values of a bin over the window in buckets of the
+// resolution, keeping a cursor on the bucket of the percentile that is
+// moved as values come and go rather than searched for.
+type histogram struct {
+	// counts[i] counts the values in bucket offset+i.
+	offset int
+	counts []uint32
+	n      int
+
+	// cursor is the bucket of the percentile, and below the number of
+	// values in the buckets under it.
+	cursor int
+	below  int
+}
+
+func (h *histogram) add(b int) {
+	switch {
+	case len(h.counts) == 0:
+		h.offset, h.cursor = b, b
+		h.counts = make([]uint32, 1, 8)
+
+	case b < h.offset:
+		grown := make([]uint32, h.offset-b+len(h.counts), h.offset-b+cap(h.counts))
+		copy(grown[h.offset-b:], h.counts)
+		h.offset, h.counts = b, grown
+
+	case b >= h.offset+len(h.counts):
+		h.counts = append(h.counts, make([]uint32, b-h.offset-len(h.counts)+1)...)
+	}
+
+	h.counts[b-h.offset]++
+	h.n++
+
+	if b < h.cursor {
+		h.below++
+	}
+}
+
+// remove takes away a value that was added.
+func (h *histogram) remove(b int) {
+	h.counts[b-h.offset]--
+	h.n--
+
+	if b < h.cursor {
+		h.below--
+	}
+}
+
+// percentile moves the cursor to the p-th percentile, p between 0 and 1, and
+// returns the centre of its bucket. It is NaN when there are no values.
+func (h *histogram) percentile(p float64) float64 {
+	if h.n == 0 {
+		return math.NaN()
+	}
+
+	rank := int(math.Round(p * float64(h.n-1)))
+
+	for h.below > rank {
+		h.cursor--
+		h.below -= int(h.counts[h.cursor-h.offset])
+	}
+
+	for h.below+int(h.counts[h.cursor-h.offset]) <= rank {
+		h.below += int(h.counts[h.cursor-h.offset])
+		h.cursor++
+	}
+
+	return (float64(h.cursor) + 0.5) * resolution
+}
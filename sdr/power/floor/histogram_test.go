@@ -0,0 +1,146 @@
+package floor
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// percentileOf returns the centre of the bucket of the p-th percentile of the
+// buckets, as percentile should.
+func percentileOf(buckets []int, p float64) float64 {
+	if len(buckets) == 0 {
+		return math.NaN()
+	}
+
+	sorted := slices.Sorted(slices.Values(buckets))
+	rank := int(math.Round(p * float64(len(sorted)-1)))
+
+	return (float64(sorted[rank]) + 0.5) * resolution
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		add    []int
+		remove []int
+		ps     []float64
+	}{
+		{
+			name: "empty",
+			ps:   []float64{0, 0.5, 1},
+		},
+		{
+			name: "one value",
+			add:  []int{-800},
+			ps:   []float64{0, 0.5, 1},
+		},
+		{
+			name: "ascending",
+			add:  []int{1, 2, 3, 4, 5},
+			ps:   []float64{0, 0.25, 0.5, 1, 0.1},
+		},
+		{
+			name: "below the first value",
+			add:  []int{10, 20, -30, 5, -1000},
+			ps:   []float64{1, 0, 0.5, 0.2},
+		},
+		{
+			name: "repeated values",
+			add:  []int{3, 3, 3, 1, 7, 7},
+			ps:   []float64{0.5, 0.1, 0.9, 0.5},
+		},
+		{
+			name:   "removed below the cursor",
+			add:    []int{1, 2, 3, 4, 5, 6},
+			remove: []int{1, 2},
+			ps:     []float64{0, 0.5, 1},
+		},
+		{
+			name:   "removed above the cursor",
+			add:    []int{1, 2, 3, 4, 5, 6},
+			remove: []int{6, 5, 4},
+			ps:     []float64{1, 0.5, 0},
+		},
+		{
+			name:   "everything removed",
+			add:    []int{1, 2},
+			remove: []int{2, 1},
+			ps:     []float64{0.5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var h histogram
+			for _, b := range test.add {
+				h.add(b)
+			}
+
+			// place the cursor before the values are removed, so that they
+			// are taken from either side of it.
+			h.percentile(0.5)
+
+			buckets := slices.Clone(test.add)
+			for _, b := range test.remove {
+				h.remove(b)
+				buckets = slices.Delete(buckets, slices.Index(buckets, b), slices.Index(buckets, b)+1)
+			}
+
+			for _, p := range test.ps {
+				got, want := h.percentile(p), percentileOf(buckets, p)
+				if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+					t.Errorf("percentile(%v) = %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestHistogramWindow slides a window over random values, as the estimator
+// does, checking every percentile read along the way.
+func TestHistogramWindow(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	values := make([]int, 2000)
+	for i := range values {
+		values[i] = bucket(r.NormFloat64()*3 - 60)
+	}
+
+	const window = 50
+
+	var h histogram
+	for i, b := range values {
+		h.add(b)
+		if i >= window {
+			h.remove(values[i-window])
+		}
+
+		p := r.Float64()
+		if got, want := h.percentile(p), percentileOf(values[max(0, i-window+1):i+1], p); got != want {
+			t.Fatalf("after %d values, percentile(%v) = %v, want %v", i+1, p, got, want)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  int
+	}{
+		{0, 0},
+		{0.04, 0},
+		{0.05, 1},
+		{-0.01, -1},
+		{-60.02, -1201},
+		{1e9, limit / resolution},
+		{math.Inf(-1), -limit / resolution},
+	}
+
+	for _, test := range tests {
+		if got := bucket(test.value); got != test.want {
+			t.Errorf("bucket(%v) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
@@ -1,13 +1,26 @@
 package history
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/olistrik/numa-sdr/api/sdr/power"
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	// ErrTooManyHops is returned by Push for a hop beyond those of a sweep.
+	ErrTooManyHops = errors.New("too many scans received")
+	// ErrTooFewHops is returned by Push when a sweep ends before all of its
+	// hops arrived.
+	ErrTooFewHops = errors.New("too few scans received")
+)
+
 type HistoryOption func(*History)
 
 func MaxDuration(duration time.Duration) HistoryOption {
@@ -16,7 +29,19 @@ func MaxDuration(duration time.Duration) HistoryOption {
 	}
 }
 
+// MaxSweeps limits the number of sweeps retained, 0 for no limit.
+func MaxSweeps(n int) HistoryOption {
+	return func(h *History) {
+		h.MaxSweeps = n
+	}
+}
+
 type History struct {
+	mu sync.RWMutex
+
+	// sweeps counts every completed sweep, it is the ID of head.
+	sweeps uint64
+
 	head *power.Scan
 	tail *power.Scan
 	next *power.Scan
@@ -24,6 +49,7 @@ type History struct {
 	Hop          uint
 	ExpectedHops uint
 	MaxDuration  time.Duration `json:"max_duration"`
+	MaxSweeps    int           `json:"max_sweeps"`
 	Scans        []*power.Scan `json:"scans"`
 }
 
@@ -40,15 +66,168 @@ func New(opts ...HistoryOption) *History {
 	return history
 }
 
+// Hops returns the number of hops expected in each sweep, 0 until the first
+// sweep is complete.
+func (hm *History) Hops() int {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	if hm.head == nil {
+		return 0
+	}
+
+	return int(hm.ExpectedHops)
+}
+
+// Len returns the number of sweeps retained.
+func (hm *History) Len() int {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	return len(hm.Scans)
+}
+
+// Bytes estimates the memory taken by the retained sweeps.
+func (hm *History) Bytes() int {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	size := 0
+	for _, scan := range hm.Scans {
+		size += int(unsafe.Sizeof(*scan)) + cap(scan.Bins)*int(unsafe.Sizeof(scan.Bins[0]))
+	}
+
+	return size
+}
+
 func (hm *History) Tail() *power.Scan {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
 	return hm.tail
 }
 
 func (hm *History) Head() *power.Scan {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
 	return hm.head
 }
 
+// Sweeps returns the number of completed sweeps. Sweeps are numbered from 1,
+// so this is also the ID of the head.
+func (hm *History) Sweeps() uint64 {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	return hm.sweeps
+}
+
+// Snapshot returns a copy of the retained sweeps and the ID of the last one.
+func (hm *History) Snapshot() ([]*power.Scan, uint64) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	return slices.Clone(hm.Scans), hm.sweeps
+}
+
+// Since returns the sweeps completed after the sweep with the given ID. It
+// returns false when some of those sweeps are no longer retained, or the ID
+// is from the future.
+func (hm *History) Since(id uint64) ([]*power.Scan, bool) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	if id > hm.sweeps {
+		return nil, false
+	}
+
+	missed := hm.sweeps - id
+	if missed > uint64(len(hm.Scans)) {
+		return nil, false
+	}
+
+	return slices.Clone(hm.Scans[len(hm.Scans)-int(missed):]), true
+}
+
+// Window returns the retained sweeps taken between from and to, inclusive. A
+// zero from or to leaves that end of the window open.
+func (hm *History) Window(from, to time.Time) []*power.Scan {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	first, _ := slices.BinarySearchFunc(hm.Scans, from, func(scan *power.Scan, t time.Time) int {
+		return scan.DateTime.Compare(t)
+	})
+
+	last := len(hm.Scans)
+	if !to.IsZero() {
+		last, _ = slices.BinarySearchFunc(hm.Scans, to, func(scan *power.Scan, t time.Time) int {
+			if scan.DateTime.After(t) {
+				return 1
+			}
+			return -1
+		})
+	}
+
+	return slices.Clone(hm.Scans[first:max(first, last)])
+}
+
+// Replay pushes every scan read from r into the history, calling fn, when it
+// is not nil, with each completed sweep. Lines that cannot be parsed or pushed
+// are logged and skipped.
+func (hm *History) Replay(r *power.Reader, fn func(*power.Scan) error) error {
+	for {
+		scan, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			var parseErr *power.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			log.Warnln(err)
+			continue
+		}
+
+		before := hm.Sweeps()
+
+		complete, err := hm.Push(scan)
+		if err != nil {
+			log.Warnln(err)
+			continue
+		}
+
+		if !complete || fn == nil {
+			continue
+		}
+
+		for _, sweep := range hm.Completed(before) {
+			if err := fn(sweep); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Completed returns the sweeps completed since the head was before, oldest
+// first. A push usually completes a single sweep, but it completes two when
+// the first sweeps of single hop scans are told apart. Sweeps that have
+// already left the history are skipped.
+func (hm *History) Completed(before uint64) []*power.Scan {
+	if sweeps, ok := hm.Since(before); ok {
+		return sweeps
+	}
+
+	return []*power.Scan{hm.Head()}
+}
+
 func (hm *History) Push(scan *power.Scan) (bool, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
 	// increment Hop; it should never 0.
 	hm.Hop++
 
@@ -71,12 +250,17 @@ func (hm *History) Push(scan *power.Scan) (bool, error) {
 		// hm.next is complete, scan is the start of the next sweep.
 		// append next to scan, and point head at it.
 
-		hm.Scans = append(hm.Scans, hm.next)
-		hm.head = hm.next
+		hm.commit(hm.next)
+		hm.next = nil
 
-		// setup next scan.
+		// setup next scan, which is already complete when sweeps are a
+		// single hop.
 		hm.Hop = 1
-		hm.next = scan
+		if hm.ExpectedHops == 1 {
+			hm.commit(scan)
+		} else {
+			hm.next = scan
+		}
 
 		// Technically this is wrong. It was completed _last_ call.
 		// However, it was _this_ loop that it was appended to scan.
@@ -88,21 +272,26 @@ func (hm *History) Push(scan *power.Scan) (bool, error) {
 	// Check if it's the start of a new scan.
 	if hm.next == nil {
 		hm.Hop = 1
-		hm.next = scan
 
+		if hm.ExpectedHops == 1 {
+			hm.commit(scan)
+			return true, nil
+		}
+
+		hm.next = scan
 		return false, nil
 	}
 
 	// Check that we've not overrun on the hops.
 	if hm.next.DateTime == scan.DateTime && hm.Hop > hm.ExpectedHops {
 		hm.next = nil
-		return false, fmt.Errorf("to many scans recieved for timestamp %s", scan.DateTime)
+		return false, fmt.Errorf("%w for timestamp %s", ErrTooManyHops, scan.DateTime)
 	}
 
 	// Check that we've not underrun on the hops.
 	if hm.next.DateTime != scan.DateTime && hm.Hop <= hm.ExpectedHops {
 		hm.next = nil
-		return false, fmt.Errorf("too few scans recieved for timestamp %s", scan.DateTime)
+		return false, fmt.Errorf("%w for timestamp %s", ErrTooFewHops, scan.DateTime)
 	}
 
 	// Append it.
@@ -118,13 +307,20 @@ func (hm *History) Push(scan *power.Scan) (bool, error) {
 		return false, nil
 	}
 
-	// sweep complete. Append it to scans and shift the head.
-	hm.Scans = append(hm.Scans, hm.next)
-	hm.head = hm.next
-
-	// start new scans.
+	// sweep complete. Append it to scans and start new scans.
+	hm.commit(hm.next)
 	hm.next = nil
 
+	return true, nil
+}
+
+// commit appends a complete sweep to scans, shifts the head and drops the
+// sweeps that no longer fit the history.
+func (hm *History) commit(sweep *power.Scan) {
+	hm.Scans = append(hm.Scans, sweep)
+	hm.head = sweep
+	hm.sweeps++
+
 	// Drop scans older than MaxHistory
 	if hm.MaxDuration > 0 {
 		for hm.head.DateTime.Sub(hm.Scans[0].DateTime) > hm.MaxDuration {
@@ -132,7 +328,9 @@ func (hm *History) Push(scan *power.Scan) (bool, error) {
 		}
 	}
 
-	hm.tail = hm.Scans[0]
+	if hm.MaxSweeps > 0 && len(hm.Scans) > hm.MaxSweeps {
+		hm.Scans = hm.Scans[len(hm.Scans)-hm.MaxSweeps:]
+	}
 
-	return true, nil
+	hm.tail = hm.Scans[0]
 }
@@ -0,0 +1,320 @@
+// Package occupancy measures how much of the time each bin is in use: the
+// fraction of sweeps in which its power is above a threshold, either an
+// absolute level or a margin above the noise of the sweep or the floor of the
+// bin.
+package occupancy
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/band"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+type Option func(*Calculator)
+
+// Occupied sets the rule by which a bin is occupied, AboveNoise(10, 0.1) by
+// default.
+func Occupied(rule Rule) Option {
+	return func(c *Calculator) {
+		c.Rule = rule
+	}
+}
+
+// Interval sets the time covered by each row of the heatmap, 10 minutes by
+// default.
+func Interval(interval time.Duration) Option {
+	return func(c *Calculator) {
+		c.Interval = interval
+	}
+}
+
+// Bands sets the bands summarised by Bands.
+func Bands(bands ...band.Band) Option {
+	return func(c *Calculator) {
+		c.bands = bands
+	}
+}
+
+// BandOccupancy summarises the occupancy of a band.
+type BandOccupancy struct {
+	band.Band
+
+	// DutyCycle is the mean duty cycle of the bins of the band, and Busy the
+	// fraction of the sweeps in which any of them was occupied, both
+	// percentages.
+	DutyCycle float64 `json:"duty_cycle"`
+	Busy      float64 `json:"busy"`
+	// Bins is the number of bins that overlap the band.
+	Bins int `json:"bins"`
+}
+
+// row counts the occupied sweeps of each bin in an interval of the heatmap.
+type row struct {
+	start    time.Time
+	sweeps   []uint32
+	occupied []uint32
+}
+
+// Calculator accumulates the occupancy of the sweeps of one frequency range
+// and number of bins.
+type Calculator struct {
+	Rule     Rule
+	Interval time.Duration
+
+	// Start and End are the times of the first and last sweep added, and
+	// Sweeps their number.
+	Start  time.Time
+	End    time.Time
+	Sweeps int
+
+	thresholds func(scan *power.Scan) []unit.Decabel
+	bands      []band.Band
+
+	layout *power.Scan
+
+	// each bin's sweeps with a value, and those occupied.
+	sweeps   []int
+	occupied []int
+
+	// each band's range of bins and sweeps with any bin occupied.
+	ranges [][2]int
+	busy   []int
+
+	rows []*row
+}
+
+func New(opts ...Option) *Calculator {
+	c := &Calculator{
+		Rule:     AboveNoise(10, 0.1),
+		Interval: 10 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Minute
+	}
+
+	c.thresholds = c.Rule.Thresholds()
+
+	return c
+}
+
+// init sets the layout of the calculator to that of the scan.
+func (c *Calculator) init(scan *power.Scan) {
+	layout := *scan
+	layout.Bins = make([]unit.Decabel, len(scan.Bins))
+	c.layout = &layout
+
+	c.sweeps = make([]int, len(scan.Bins))
+	c.occupied = make([]int, len(scan.Bins))
+	c.Start = scan.DateTime
+
+	width := layout.BinWidth()
+	for _, b := range c.bands {
+		slice := layout.Slice(b.Start, b.End)
+
+		first := 0
+		if width > 0 {
+			first = int(math.Round(float64((slice.StartFrequency - layout.StartFrequency) / width)))
+		}
+		c.ranges = append(c.ranges, [2]int{first, first + len(slice.Bins)})
+	}
+	c.busy = make([]int, len(c.bands))
+}
+
+// Add accumulates a sweep. Sweeps whose frequency range or number of bins
+// differ from the first are not added, and it returns false.
+func (c *Calculator) Add(scan *power.Scan) bool {
+	if c.layout == nil {
+		c.init(scan)
+	} else if !c.layout.SameLayout(scan) {
+		return false
+	}
+
+	thresholds := c.thresholds(scan)
+
+	slot := scan.DateTime.Truncate(c.Interval)
+	if len(c.rows) == 0 || !c.rows[len(c.rows)-1].start.Equal(slot) {
+		c.rows = append(c.rows, &row{
+			start:    slot,
+			sweeps:   make([]uint32, len(scan.Bins)),
+			occupied: make([]uint32, len(scan.Bins)),
+		})
+	}
+	r := c.rows[len(c.rows)-1]
+
+	c.End = scan.DateTime
+	c.Sweeps++
+
+	occupied := make([]bool, len(scan.Bins))
+	for i, bin := range scan.Bins {
+		threshold := thresholds[i]
+		if math.IsNaN(float64(bin)) || math.IsNaN(float64(threshold)) {
+			continue
+		}
+
+		c.sweeps[i]++
+		r.sweeps[i]++
+
+		if bin > threshold {
+			occupied[i] = true
+			c.occupied[i]++
+			r.occupied[i]++
+		}
+	}
+
+	for i, bins := range c.ranges {
+		for _, o := range occupied[bins[0]:bins[1]] {
+			if o {
+				c.busy[i]++
+				break
+			}
+		}
+	}
+
+	return true
+}
+
+// percent returns n as a percentage of total, NaN when total is 0.
+func percent[T int | uint32](n, total T) float64 {
+	if total == 0 {
+		return math.NaN()
+	}
+
+	return 100 * float64(n) / float64(total)
+}
+
+// DutyCycle returns the percentage of the sweeps in which each bin was
+// occupied, NaN for bins without values.
+func (c *Calculator) DutyCycle() []float64 {
+	duty := make([]float64, len(c.sweeps))
+	for i := range duty {
+		duty[i] = percent(c.occupied[i], c.sweeps[i])
+	}
+
+	return duty
+}
+
+// Frequencies returns the lower edge of each bin.
+func (c *Calculator) Frequencies() []unit.Frequency {
+	if c.layout == nil {
+		return []unit.Frequency{}
+	}
+
+	frequencies := make([]unit.Frequency, len(c.sweeps))
+	for i := range frequencies {
+		frequencies[i] = c.layout.Frequency(i)
+	}
+
+	return frequencies
+}
+
+// Bands summarises the occupancy of each band.
+func (c *Calculator) Bands() []BandOccupancy {
+	summaries := make([]BandOccupancy, len(c.bands))
+	duty := c.DutyCycle()
+
+	for i, b := range c.bands {
+		summaries[i] = BandOccupancy{Band: b, DutyCycle: math.NaN(), Busy: math.NaN()}
+		if c.layout == nil {
+			continue
+		}
+
+		bins := c.ranges[i]
+		summaries[i].Bins = bins[1] - bins[0]
+
+		total, n := 0.0, 0
+		for _, value := range duty[bins[0]:bins[1]] {
+			if !math.IsNaN(value) {
+				total += value
+				n++
+			}
+		}
+
+		if n > 0 {
+			summaries[i].DutyCycle = total / float64(n)
+			summaries[i].Busy = percent(c.busy[i], c.Sweeps)
+		}
+	}
+
+	return summaries
+}
+
+// Heatmap returns a scan per interval, oldest first, whose bins hold the
+// percentage of its sweeps in which they were occupied rather than a power.
+func (c *Calculator) Heatmap() []*power.Scan {
+	scans := make([]*power.Scan, len(c.rows))
+
+	for i, r := range c.rows {
+		scan := *c.layout
+		scan.DateTime = r.start
+		scan.Bins = make([]unit.Decabel, len(r.sweeps))
+
+		for bin := range scan.Bins {
+			scan.Bins[bin] = unit.Decabel(percent(r.occupied[bin], r.sweeps[bin]))
+		}
+
+		scans[i] = &scan
+	}
+
+	return scans
+}
+
+// formatPercent formats a percentage for CSV, empty when it is NaN.
+func formatPercent(value float64) string {
+	if math.IsNaN(value) {
+		return ""
+	}
+
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// WriteCSV writes a row per bin: its lower edge in Hz, its duty cycle as a
+// percentage and the number of sweeps it had a value in.
+func (c *Calculator) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"frequency_hz", "duty_cycle_percent", "sweeps"})
+
+	if c.layout != nil {
+		for i, duty := range c.DutyCycle() {
+			cw.Write([]string{
+				strconv.FormatFloat(float64(c.layout.Frequency(i)), 'f', 0, 64),
+				formatPercent(duty),
+				strconv.Itoa(c.sweeps[i]),
+			})
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteBandsCSV writes a row per band with its duty cycle and busy
+// percentages.
+func (c *Calculator) WriteBandsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"band", "start_hz", "end_hz", "duty_cycle_percent", "busy_percent", "bins"})
+
+	for _, b := range c.Bands() {
+		cw.Write([]string{
+			b.Name,
+			strconv.FormatFloat(float64(b.Start), 'f', 0, 64),
+			strconv.FormatFloat(float64(b.End), 'f', 0, 64),
+			formatPercent(b.DutyCycle),
+			formatPercent(b.Busy),
+			strconv.Itoa(b.Bins),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,118 @@
+package occupancy
+
+import (
+	"math"
+	"slices"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/floor"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// reference is what the level of a rule is relative to.
+type reference int
+
+const (
+	absolute reference = iota
+	noise
+	binFloor
+)
+
+// Rule decides the threshold above which a bin of a sweep is occupied.
+type Rule struct {
+	// Level is the threshold, or the margin above the noise or the floor.
+	Level unit.Decabel
+
+	// Noise is the percentile of the bins of each sweep taken as its noise,
+	// for a margin above the noise.
+	Noise float64
+
+	reference reference
+	floor     []floor.Option
+}
+
+// Threshold counts a bin as occupied when its power is above the level.
+func Threshold(level unit.Decabel) Rule {
+	return Rule{Level: level}
+}
+
+// AboveNoise counts a bin as occupied when its power is more than margin
+// above the noise of its sweep, the percentile of the power of all of its
+// bins, between 0 and 1. As the noise is taken across frequency rather than
+// over time, a bin that is busy all of the time is still counted, so long as
+// the percentile of the sweep is quiet. This is the default, 10 dB above the
+// 10th percentile.
+func AboveNoise(margin unit.Decabel, percentile float64) Rule {
+	return Rule{Level: margin, Noise: max(0, min(1, percentile)), reference: noise}
+}
+
+// AboveFloor counts a bin as occupied when its power is more than margin
+// above its own noise floor over time. The floor is estimated over the
+// window up to and including the sweep, so a bin that is busy for much of
+// the window raises its own floor and is undercounted; a low
+// floor.Percentile keeps it down.
+func AboveFloor(margin unit.Decabel, opts ...floor.Option) Rule {
+	return Rule{Level: margin, reference: binFloor, floor: opts}
+}
+
+// Relative reports whether the level is relative to the noise or the floor.
+func (r Rule) Relative() bool {
+	return r.reference != absolute
+}
+
+// Thresholds returns a function giving the threshold of each bin of each
+// sweep, NaN where it is not known. The slice it returns is reused. Above
+// the floor it keeps an estimate of the floor of its own, so the sweeps must
+// be given to it in order.
+func (r Rule) Thresholds() func(scan *power.Scan) []unit.Decabel {
+	var thresholds []unit.Decabel
+	var values []float64
+
+	fill := func(scan *power.Scan, level unit.Decabel) []unit.Decabel {
+		thresholds = slices.Grow(thresholds[:0], len(scan.Bins))[:len(scan.Bins)]
+		for i := range thresholds {
+			thresholds[i] = level
+		}
+		return thresholds
+	}
+
+	switch r.reference {
+	case noise:
+		return func(scan *power.Scan) []unit.Decabel {
+			values = values[:0]
+			for _, bin := range scan.Bins {
+				if value := float64(bin); !math.IsNaN(value) && !math.IsInf(value, 0) {
+					values = append(values, value)
+				}
+			}
+
+			if len(values) == 0 {
+				return fill(scan, unit.Decabel(math.NaN()))
+			}
+
+			slices.Sort(values)
+			level := values[int(math.Round(r.Noise*float64(len(values)-1)))]
+
+			return fill(scan, unit.Decabel(level)+r.Level)
+		}
+
+	case binFloor:
+		estimator := floor.New(r.floor...)
+
+		return func(scan *power.Scan) []unit.Decabel {
+			estimator.Push(scan)
+
+			thresholds = fill(scan, r.Level)
+			for i, bin := range estimator.Floor().Bins {
+				thresholds[i] += bin
+			}
+
+			return thresholds
+		}
+
+	default:
+		return func(scan *power.Scan) []unit.Decabel {
+			return fill(scan, r.Level)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+// Package profile folds long recordings onto a day or a week, giving the mean
+// power and occupancy of each bin at each time of day or day of the week, so
+// that interference that follows a schedule stands out.
+package profile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/export"
+	"github.com/olistrik/numa-sdr/api/internal/atomicfile"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/sdr/power/occupancy"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Period is the time a profile folds the sweeps onto.
+type Period string
+
+const (
+	// Daily profiles the time of day.
+	Daily Period = "daily"
+	// Weekly profiles the day of the week, from Monday.
+	Weekly Period = "weekly"
+)
+
+func (p *Period) UnmarshalText(b []byte) error {
+	switch period := Period(b); period {
+	case Daily, Weekly:
+		*p = period
+		return nil
+	default:
+		return fmt.Errorf("unknown period %q, expected daily or weekly", b)
+	}
+}
+
+// Duration returns the length of the period.
+func (p Period) Duration() time.Duration {
+	if p == Weekly {
+		return 7 * 24 * time.Hour
+	}
+
+	return 24 * time.Hour
+}
+
+// DefaultSlot returns the default time covered by each row of a profile of
+// the period, an hour of the day or a day of the week.
+func (p Period) DefaultSlot() time.Duration {
+	if p == Weekly {
+		return 24 * time.Hour
+	}
+
+	return time.Hour
+}
+
+type Option func(*Profile)
+
+// Slot sets the time covered by each row, which must divide the period. The
+// default is the period's DefaultSlot.
+func Slot(slot time.Duration) Option {
+	return func(p *Profile) {
+		p.Slot = slot
+	}
+}
+
+// Occupied sets the rule by which a bin is occupied, as for the occupancy,
+// occupancy.AboveNoise(10, 0.1) by default.
+func Occupied(rule occupancy.Rule) Option {
+	return func(p *Profile) {
+		p.Rule = rule
+	}
+}
+
+// Profile accumulates the sweeps of one frequency range and number of bins
+// into a row per slot of the period. Times are taken as the wall clock
+// rtl_power recorded them in.
+type Profile struct {
+	Period Period
+	Slot   time.Duration
+
+	Rule occupancy.Rule
+
+	// Start and End are the times of the first and last sweep added, and
+	// Sweeps their number.
+	Start  time.Time
+	End    time.Time
+	Sweeps int
+
+	thresholds func(scan *power.Scan) []unit.Decabel
+	layout     *power.Scan
+
+	// each row's sweeps, and each bin's sweeps with a value, linear sum and
+	// occupied sweeps.
+	rows     []int
+	counts   [][]uint32
+	linear   [][]float64
+	occupied [][]uint32
+}
+
+func New(period Period, opts ...Option) (*Profile, error) {
+	p := &Profile{
+		Period: period,
+		Slot:   period.DefaultSlot(),
+		Rule:   occupancy.AboveNoise(10, 0.1),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.Slot <= 0 || period.Duration()%p.Slot != 0 {
+		return nil, fmt.Errorf("slot %v does not divide the %s period", p.Slot, period)
+	}
+
+	p.thresholds = p.Rule.Thresholds()
+
+	return p, nil
+}
+
+// Rows returns the number of slots in the period.
+func (p *Profile) Rows() int {
+	return int(p.Period.Duration() / p.Slot)
+}
+
+// offset returns the time since the start of the period.
+func (p *Profile) offset(t time.Time) time.Duration {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if p.Period == Weekly {
+		// time.Weekday counts from Sunday.
+		offset += time.Duration((int(t.Weekday())+6)%7) * 24 * time.Hour
+	}
+
+	return offset
+}
+
+// Offsets returns the start of each row as the time since the start of the
+// period.
+func (p *Profile) Offsets() []time.Duration {
+	offsets := make([]time.Duration, p.Rows())
+	for i := range offsets {
+		offsets[i] = time.Duration(i) * p.Slot
+	}
+
+	return offsets
+}
+
+// labelFormat returns the layout of the labels of the rows.
+func (p *Profile) labelFormat() string {
+	switch {
+	case p.Period == Daily:
+		return "15:04"
+	case p.Slot%(24*time.Hour) == 0:
+		return "Mon"
+	default:
+		return "Mon 15:04"
+	}
+}
+
+// epoch is a Monday midnight, from which the rows are dated.
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Labels returns the start of each row as the time of day, or the day of the
+// week.
+func (p *Profile) Labels() []string {
+	labels := make([]string, p.Rows())
+	for i, offset := range p.Offsets() {
+		labels[i] = epoch.Add(offset).Format(p.labelFormat())
+	}
+
+	return labels
+}
+
+// Reset discards the sweeps added so far.
+func (p *Profile) Reset() {
+	p.layout = nil
+	p.Sweeps = 0
+	p.Start, p.End = time.Time{}, time.Time{}
+	p.thresholds = p.Rule.Thresholds()
+}
+
+// Add accumulates a sweep. Sweeps whose frequency range or number of bins
+// differ from the first are not added, and it returns false.
+func (p *Profile) Add(scan *power.Scan) bool {
+	if p.layout == nil {
+		layout := *scan
+		layout.Bins = make([]unit.Decabel, len(scan.Bins))
+		p.layout = &layout
+
+		p.rows = make([]int, p.Rows())
+		p.counts = make([][]uint32, p.Rows())
+		p.linear = make([][]float64, p.Rows())
+		p.occupied = make([][]uint32, p.Rows())
+		for i := range p.Rows() {
+			p.counts[i] = make([]uint32, len(scan.Bins))
+			p.linear[i] = make([]float64, len(scan.Bins))
+			p.occupied[i] = make([]uint32, len(scan.Bins))
+		}
+
+		p.Start = scan.DateTime
+	} else if !p.layout.SameLayout(scan) {
+		return false
+	}
+
+	thresholds := p.thresholds(scan)
+
+	row := int(p.offset(scan.DateTime) / p.Slot)
+
+	p.rows[row]++
+	p.End = scan.DateTime
+	p.Sweeps++
+
+	for i, bin := range scan.Bins {
+		if math.IsNaN(float64(bin)) || math.IsInf(float64(bin), 0) {
+			continue
+		}
+
+		p.counts[row][i]++
+		p.linear[row][i] += math.Pow(10, float64(bin)/10)
+
+		if bin > thresholds[i] {
+			p.occupied[row][i]++
+		}
+	}
+
+	return true
+}
+
+// matrix returns a row per slot and a column per bin of fn, NaN where there
+// were no values.
+func (p *Profile) matrix(fn func(row, bin int) float64) [][]float64 {
+	matrix := make([][]float64, p.Rows())
+	for row := range matrix {
+		if p.layout == nil {
+			matrix[row] = []float64{}
+			continue
+		}
+
+		matrix[row] = make([]float64, len(p.layout.Bins))
+		for bin := range matrix[row] {
+			if p.counts[row][bin] == 0 {
+				matrix[row][bin] = math.NaN()
+			} else {
+				matrix[row][bin] = fn(row, bin)
+			}
+		}
+	}
+
+	return matrix
+}
+
+// Mean returns the mean power in dB of each bin in each slot, averaged in
+// linear power.
+func (p *Profile) Mean() [][]float64 {
+	return p.matrix(func(row, bin int) float64 {
+		return 10 * math.Log10(p.linear[row][bin]/float64(p.counts[row][bin]))
+	})
+}
+
+// Occupancy returns the percentage of the sweeps in which each bin was
+// occupied in each slot.
+func (p *Profile) Occupancy() [][]float64 {
+	return p.matrix(func(row, bin int) float64 {
+		return 100 * float64(p.occupied[row][bin]) / float64(p.counts[row][bin])
+	})
+}
+
+// RowSweeps returns the number of sweeps added to each slot.
+func (p *Profile) RowSweeps() []int {
+	sweeps := make([]int, p.Rows())
+	copy(sweeps, p.rows)
+
+	return sweeps
+}
+
+// Frequencies returns the lower edge of each bin.
+func (p *Profile) Frequencies() []unit.Frequency {
+	if p.layout == nil {
+		return []unit.Frequency{}
+	}
+
+	frequencies := make([]unit.Frequency, len(p.layout.Bins))
+	for i := range frequencies {
+		frequencies[i] = p.layout.Frequency(i)
+	}
+
+	return frequencies
+}
+
+// Heatmap returns the matrix as a scan per slot, dated from a Monday
+// midnight, for drawing as a waterfall with the TimeFormat of the rows. They
+// are ordered from the end of the period, so that it starts at the top.
+func (p *Profile) Heatmap(matrix [][]float64) ([]*power.Scan, string) {
+	if p.layout == nil {
+		return nil, p.labelFormat()
+	}
+
+	scans := make([]*power.Scan, len(matrix))
+	offsets := p.Offsets()
+
+	for i, values := range matrix {
+		scan := *p.layout
+		scan.DateTime = epoch.Add(offsets[i])
+		scan.Bins = make([]unit.Decabel, len(values))
+		for bin, value := range values {
+			scan.Bins[bin] = unit.Decabel(value)
+		}
+
+		scans[len(matrix)-1-i] = &scan
+	}
+
+	return scans, p.labelFormat()
+}
+
+// WriteCSV writes the matrix with a row per slot, labelled by its start, and
+// a column per bin, headed by its lower edge in Hz. Slots without values are
+// left empty.
+func (p *Profile) WriteCSV(w io.Writer, matrix [][]float64) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"slot"}
+	for _, f := range p.Frequencies() {
+		header = append(header, strconv.FormatFloat(float64(f), 'f', 0, 64))
+	}
+	cw.Write(header)
+
+	labels := p.Labels()
+	for i, values := range matrix {
+		row := []string{labels[i]}
+		for _, value := range values {
+			cell := ""
+			if !math.IsNaN(value) {
+				cell = strconv.FormatFloat(value, 'f', 2, 64)
+			}
+			row = append(row, cell)
+		}
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteNpz writes a .npz archive holding `mean` and `occupancy`, with a row
+// per slot and a column per bin, the start of each slot as `slots` in seconds
+// from the start of the period, its number of sweeps as `sweeps` and the
+// lower edge of each bin as `frequencies`.
+func (p *Profile) WriteNpz(w io.Writer) error {
+	slots := make([]float64, p.Rows())
+	for i, offset := range p.Offsets() {
+		slots[i] = offset.Seconds()
+	}
+
+	sweeps := make([]float64, p.Rows())
+	for i, n := range p.RowSweeps() {
+		sweeps[i] = float64(n)
+	}
+
+	frequencies := []float64{}
+	for _, f := range p.Frequencies() {
+		frequencies = append(frequencies, float64(f))
+	}
+
+	return export.WriteNpzArrays(w,
+		export.Array{Name: "mean", Write: func(w io.Writer) error { return export.WriteNpy2(w, p.Mean()) }},
+		export.Array{Name: "occupancy", Write: func(w io.Writer) error { return export.WriteNpy2(w, p.Occupancy()) }},
+		export.Array{Name: "slots", Write: func(w io.Writer) error { return export.WriteNpy(w, slots) }},
+		export.Array{Name: "sweeps", Write: func(w io.Writer) error { return export.WriteNpy(w, sweeps) }},
+		export.Array{Name: "frequencies", Write: func(w io.Writer) error { return export.WriteNpy(w, frequencies) }},
+	)
+}
+
+// state is the accumulated sweeps of a profile, as saved.
+type state struct {
+	Period   Period        `json:"period"`
+	Slot     time.Duration `json:"slot"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Sweeps   int           `json:"sweeps"`
+	Layout   *power.Scan   `json:"layout"`
+	Rows     []int         `json:"rows"`
+	Counts   [][]uint32    `json:"counts"`
+	Linear   [][]float64   `json:"linear"`
+	Occupied [][]uint32    `json:"occupied"`
+}
+
+// Load restores the sweeps saved to the file, which must be of a profile of
+// the same period and slot. The noise floor is estimated afresh.
+func (p *Profile) Load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	if s.Period != p.Period || s.Slot != p.Slot {
+		return fmt.Errorf("%s: the profile is %s by %v, not %s by %v", file, s.Period, s.Slot, p.Period, p.Slot)
+	}
+
+	if s.Layout == nil {
+		return nil
+	}
+
+	bins := len(s.Layout.Bins)
+	valid := len(s.Rows) == p.Rows() && len(s.Counts) == p.Rows() && len(s.Linear) == p.Rows() && len(s.Occupied) == p.Rows()
+	for row := 0; valid && row < p.Rows(); row++ {
+		valid = len(s.Counts[row]) == bins && len(s.Linear[row]) == bins && len(s.Occupied[row]) == bins
+	}
+	if !valid {
+		return fmt.Errorf("%s: the rows do not match the profile", file)
+	}
+
+	p.Start, p.End, p.Sweeps = s.Start, s.End, s.Sweeps
+	p.layout = s.Layout
+	p.rows, p.counts, p.linear, p.occupied = s.Rows, s.Counts, s.Linear, s.Occupied
+
+	return nil
+}
+
+// Save writes the sweeps accumulated so far to a temporary file that replaces
+// the file, so that a crash cannot leave it half written.
+func (p *Profile) Save(file string) error {
+	data, err := json.Marshal(state{
+		Period:   p.Period,
+		Slot:     p.Slot,
+		Start:    p.Start,
+		End:      p.End,
+		Sweeps:   p.Sweeps,
+		Layout:   p.layout,
+		Rows:     p.rows,
+		Counts:   p.counts,
+		Linear:   p.linear,
+		Occupied: p.occupied,
+	})
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(file, data)
+}
@@ -0,0 +1,50 @@
+package power
+
+import (
+	"math"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// QuantizedNaN marks a bin of a QuantizedScan that is not a number. Values
+// out of the range of an int32, infinities included, are clamped to
+// [QuantizedNaN+1, math.MaxInt32].
+const QuantizedNaN = math.MinInt32
+
+// QuantizedScan is a compact representation of a Scan. Each bin is rounded
+// to a multiple of Step and stored as an integer, which is considerably
+// shorter than a float64 once serialised as text.
+type QuantizedScan struct {
+	DateTime       time.Time      `json:"date_time"`
+	StartFrequency unit.Frequency `json:"start_frequency"`
+	EndFrequency   unit.Frequency `json:"end_frequency"`
+	SampleRate     unit.Frequency `json:"sample_rate"`
+	Step           unit.Decabel   `json:"step"`
+	Bins           []int32        `json:"bins"`
+}
+
+// Quantize rounds the bins of the scan to the nearest multiple of step.
+// Bins that are not a number are stored as QuantizedNaN.
+func (scan *Scan) Quantize(step unit.Decabel) *QuantizedScan {
+	quantized := &QuantizedScan{
+		DateTime:       scan.DateTime,
+		StartFrequency: scan.StartFrequency,
+		EndFrequency:   scan.EndFrequency,
+		SampleRate:     scan.SampleRate,
+		Step:           step,
+		Bins:           make([]int32, len(scan.Bins)),
+	}
+
+	for i, bin := range scan.Bins {
+		value := math.Round(float64(bin / step))
+		if math.IsNaN(value) {
+			quantized.Bins[i] = QuantizedNaN
+			continue
+		}
+
+		quantized.Bins[i] = int32(max(QuantizedNaN+1, min(math.MaxInt32, value)))
+	}
+
+	return quantized
+}
@@ -0,0 +1,86 @@
+package power
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// ParseError is returned by Reader.Read for a line that is not a valid scan.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", err.Line, err.Err)
+}
+
+func (err *ParseError) Unwrap() error {
+	return err.Err
+}
+
+// Reader reads scans from rtl_power CSV output, one per line.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    string
+	number  int
+
+	// Offset is added to the frequencies of every scan, for recordings made
+	// through an up/down converter.
+	Offset unit.Frequency
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+
+	// wide sweeps produce very long lines.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	return &Reader{scanner: scanner}
+}
+
+// Read returns the next scan. It returns io.EOF once the input is exhausted.
+// A line that cannot be parsed returns a *ParseError, and the next call
+// continues with the following line.
+func (r *Reader) Read() (*Scan, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	r.line = r.scanner.Text()
+	r.number++
+
+	scan, err := ParseScan(r.line)
+	if err != nil {
+		return nil, &ParseError{r.number, err}
+	}
+
+	scan.StartFrequency += r.Offset
+	scan.EndFrequency += r.Offset
+
+	return scan, nil
+}
+
+// Line returns the raw text of the line last read.
+func (r *Reader) Line() string {
+	return r.line
+}
+
+// ParseTime parses a timestamp given either in RFC 3339 or in the
+// `2006-01-02 15:04:05` layout used by rtl_power.
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.DateTime} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", value)
+}
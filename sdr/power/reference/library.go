@@ -0,0 +1,124 @@
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Library keeps named references as a file each in a directory. Without a
+// directory they are only held in memory.
+type Library struct {
+	Dir string
+
+	mu         sync.RWMutex
+	references map[string]*Reference
+}
+
+// Open returns the library of the references in the directory, creating it
+// when it does not exist.
+func Open(dir string) (*Library, error) {
+	l := &Library{
+		Dir:        dir,
+		references: map[string]*Reference{},
+	}
+
+	if dir == "" {
+		return l, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		r, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// the file name is the name, whatever the file says.
+		r.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+		if ValidName(r.Name) != nil {
+			continue
+		}
+
+		l.references[r.Name] = r
+	}
+
+	return l, nil
+}
+
+func (l *Library) file(n string) string {
+	return filepath.Join(l.Dir, n+".json")
+}
+
+// List returns the references ordered by name.
+func (l *Library) List() []*Reference {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	references := []*Reference{}
+	for _, n := range slices.Sorted(maps.Keys(l.references)) {
+		references = append(references, l.references[n])
+	}
+
+	return references
+}
+
+// Get returns the reference with the name.
+func (l *Library) Get(n string) (*Reference, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	r, ok := l.references[n]
+	return r, ok
+}
+
+// Add saves the reference, replacing any of the same name.
+func (l *Library) Add(r *Reference) error {
+	if err := ValidName(r.Name); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Dir != "" {
+		if err := r.Save(l.file(r.Name)); err != nil {
+			return err
+		}
+	}
+
+	l.references[r.Name] = r
+	return nil
+}
+
+// Delete removes the reference with the name.
+func (l *Library) Delete(n string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.references[n]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, n)
+	}
+
+	if l.Dir != "" {
+		if err := os.Remove(l.file(n)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	delete(l.references, n)
+	return nil
+}
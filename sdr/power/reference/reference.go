@@ -0,0 +1,216 @@
+// Package reference captures the mean spectrum of a quiet period, so that
+// later sweeps can be given as the difference from it and only what changed
+// stands out.
+package reference
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/internal/atomicfile"
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+var (
+	// ErrInvalid is returned for a reference that cannot be captured or
+	// saved.
+	ErrInvalid = errors.New("invalid reference")
+	// ErrNotFound is returned for a reference that does not exist.
+	ErrNotFound = errors.New("reference not found")
+)
+
+// name limits reference names to what can be used as a file name.
+var name = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Reference is the mean spectrum of the sweeps of a time window.
+type Reference struct {
+	Name string `json:"name"`
+
+	// Start and End are the times of the first and last sweep averaged, and
+	// Sweeps their number.
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Sweeps int       `json:"sweeps"`
+
+	Created time.Time `json:"created"`
+
+	// Spectrum holds the mean power of each bin, dated by the last sweep.
+	Spectrum *power.Scan `json:"spectrum"`
+}
+
+// ValidName checks that a reference name is made of letters, digits, _ and
+// -.
+func ValidName(n string) error {
+	if !name.MatchString(n) {
+		return fmt.Errorf("%w: name %q must be letters, digits, _ and -", ErrInvalid, n)
+	}
+
+	return nil
+}
+
+// Capture averages the sweeps into a reference. The mean is taken in linear
+// power. Only the sweeps with the frequency range and number of bins of the
+// last are averaged, and only their finite bins. Bins without any are NaN,
+// and a capture where every bin is without any is rejected.
+func Capture(n string, sweeps []*power.Scan) (*Reference, error) {
+	if err := ValidName(n); err != nil {
+		return nil, err
+	}
+
+	if len(sweeps) == 0 {
+		return nil, fmt.Errorf("%w: there are no sweeps to average", ErrInvalid)
+	}
+
+	last := sweeps[len(sweeps)-1]
+
+	sums := make([]float64, len(last.Bins))
+	counts := make([]int, len(last.Bins))
+
+	r := &Reference{
+		Name:    n,
+		End:     last.DateTime,
+		Created: time.Now().UTC(),
+	}
+
+	for _, sweep := range sweeps {
+		if !sweep.SameLayout(last) {
+			continue
+		}
+
+		if r.Sweeps == 0 {
+			r.Start = sweep.DateTime
+		}
+		r.Sweeps++
+
+		for i, bin := range sweep.Bins {
+			if value := float64(bin); !math.IsNaN(value) && !math.IsInf(value, 0) {
+				sums[i] += math.Pow(10, float64(bin)/10)
+				counts[i]++
+			}
+		}
+	}
+
+	spectrum := *last
+	spectrum.Bins = make([]unit.Decabel, len(sums))
+	empty := 0
+	for i, sum := range sums {
+		if counts[i] == 0 {
+			spectrum.Bins[i] = unit.Decabel(math.NaN())
+			empty++
+			continue
+		}
+
+		spectrum.Bins[i] = unit.Decabel(10 * math.Log10(sum/float64(counts[i])))
+	}
+
+	if empty == len(sums) {
+		return nil, fmt.Errorf("%w: the sweeps have no finite bins to average", ErrInvalid)
+	}
+	r.Spectrum = &spectrum
+
+	return r, nil
+}
+
+// at returns the power of the reference at a frequency, interpolated linearly
+// between the centres of its bins. It is false outside the bins.
+func (r *Reference) at(f unit.Frequency) (unit.Decabel, bool) {
+	spectrum := r.Spectrum
+	width := spectrum.BinWidth()
+	if width <= 0 || f < spectrum.StartFrequency || f > spectrum.EndFrequency {
+		return 0, false
+	}
+
+	// the position of f in bins, from the centre of the first.
+	x := float64((f-spectrum.StartFrequency)/width) - 0.5
+	last := len(spectrum.Bins) - 1
+
+	switch {
+	case x <= 0:
+		return spectrum.Bins[0], true
+	case x >= float64(last):
+		return spectrum.Bins[last], true
+	}
+
+	i := int(x)
+	t := unit.Decabel(x - float64(i))
+
+	return spectrum.Bins[i]*(1-t) + spectrum.Bins[i+1]*t, true
+}
+
+// Difference returns the scan less the reference. When their bins differ the
+// reference is interpolated at the centre of each bin of the scan, and the
+// scan is cut to the bins the reference covers.
+func (r *Reference) Difference(scan *power.Scan) *power.Scan {
+	spectrum := r.Spectrum
+
+	difference := *scan
+
+	if scan.SameLayout(spectrum) {
+		difference.Bins = make([]unit.Decabel, len(scan.Bins))
+		for i, bin := range scan.Bins {
+			difference.Bins[i] = bin - spectrum.Bins[i]
+		}
+
+		return &difference
+	}
+
+	width := scan.BinWidth()
+	first, last := len(scan.Bins), 0
+	bins := make([]unit.Decabel, 0, len(scan.Bins))
+
+	for i, bin := range scan.Bins {
+		value, ok := r.at(scan.Frequency(i) + width/2)
+		if !ok {
+			continue
+		}
+
+		first, last = min(first, i), i+1
+		bins = append(bins, bin-value)
+	}
+
+	if len(bins) == 0 {
+		first = 0
+	}
+
+	difference.StartFrequency = scan.Frequency(first)
+	difference.EndFrequency = scan.Frequency(max(first, last))
+	difference.Bins = bins
+
+	return &difference
+}
+
+// Load reads a reference saved by Save.
+func Load(file string) (*Reference, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Reference
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	if r.Spectrum == nil || len(r.Spectrum.Bins) == 0 {
+		return nil, fmt.Errorf("%s: %w: it has no spectrum", file, ErrInvalid)
+	}
+
+	return &r, nil
+}
+
+// Save writes the reference to a temporary file that replaces the file, so
+// that a crash cannot leave it half written.
+func (r *Reference) Save(file string) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(file, data)
+}
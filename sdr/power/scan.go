@@ -1,7 +1,11 @@
 package power
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -9,6 +13,10 @@ import (
 	"github.com/olistrik/numa-sdr/api/unit"
 )
 
+// ErrTooFewFields is returned by ParseScan for a line that is too short to be
+// a scan.
+var ErrTooFewFields = errors.New("too few fields")
+
 type Scan struct {
 	DateTime       time.Time      `json:"date_time"`
 	StartFrequency unit.Frequency `json:"start_frequency"`
@@ -26,6 +34,10 @@ func ParseScan(line string) (*Scan, error) {
 		data[i] = strings.Trim(data[i], " ")
 	}
 
+	if len(data) < 7 {
+		return nil, fmt.Errorf("%w, expected at least 7, got %d", ErrTooFewFields, len(data))
+	}
+
 	/* DateTime */
 	date, err := time.Parse(time.DateTime, data[0]+" "+data[1])
 	if err != nil {
@@ -95,3 +107,120 @@ func (scan *Scan) Append(next *Scan) error {
 
 	return nil
 }
+
+// BinWidth returns the bandwidth covered by each bin of the scan.
+func (scan *Scan) BinWidth() unit.Frequency {
+	if len(scan.Bins) == 0 {
+		return 0
+	}
+
+	return (scan.EndFrequency - scan.StartFrequency) / unit.Frequency(len(scan.Bins))
+}
+
+// SameLayout reports whether the scans have the same frequency range and
+// number of bins, so that their bins can be compared one for one.
+func (scan *Scan) SameLayout(other *Scan) bool {
+	return scan.StartFrequency == other.StartFrequency && scan.EndFrequency == other.EndFrequency && len(scan.Bins) == len(other.Bins)
+}
+
+// Frequency returns the lower edge of the i-th bin.
+func (scan *Scan) Frequency(i int) unit.Frequency {
+	return scan.StartFrequency + scan.BinWidth()*unit.Frequency(i)
+}
+
+// Slice returns the part of the scan whose bins overlap [start, end). The
+// bins are shared with the original scan.
+func (scan *Scan) Slice(start, end unit.Frequency) *Scan {
+	width := scan.BinWidth()
+	if width <= 0 {
+		return scan
+	}
+
+	first := int(math.Floor(float64((start - scan.StartFrequency) / width)))
+	last := int(math.Ceil(float64((end - scan.StartFrequency) / width)))
+
+	first = max(0, min(first, len(scan.Bins)))
+	last = max(first, min(last, len(scan.Bins)))
+
+	slice := *scan
+	slice.StartFrequency = scan.Frequency(first)
+	slice.EndFrequency = scan.Frequency(last)
+	slice.Bins = scan.Bins[first:last:last]
+
+	return &slice
+}
+
+// Decimate reduces the scan to at most columns bins. Each column holds the
+// maximum of the bins it covers so that narrow peaks remain visible.
+func (scan *Scan) Decimate(columns int) *Scan {
+	n := len(scan.Bins)
+	if columns <= 0 || n <= columns {
+		return scan
+	}
+
+	decimated := *scan
+	decimated.Bins = make([]unit.Decabel, columns)
+
+	for col := range columns {
+		first := col * n / columns
+		last := (col + 1) * n / columns
+
+		decimated.Bins[col] = slices.Max(scan.Bins[first:last])
+	}
+
+	return &decimated
+}
+
+// scanFields is Scan without its methods, for encoding its other fields.
+type scanFields Scan
+
+// MarshalJSON encodes the scan with null for bins that are not finite, such
+// as the SNR of a bin without a floor, which JSON cannot hold.
+func (scan Scan) MarshalJSON() ([]byte, error) {
+	bins := make([]byte, 0, 2+8*len(scan.Bins))
+	bins = append(bins, '[')
+
+	for i, bin := range scan.Bins {
+		if i > 0 {
+			bins = append(bins, ',')
+		}
+
+		if value := float64(bin); math.IsNaN(value) || math.IsInf(value, 0) {
+			bins = append(bins, "null"...)
+		} else {
+			bins = strconv.AppendFloat(bins, value, 'g', -1, 64)
+		}
+	}
+
+	return json.Marshal(struct {
+		*scanFields
+		Bins json.RawMessage `json:"bins"`
+	}{(*scanFields)(&scan), append(bins, ']')})
+}
+
+// UnmarshalJSON decodes a scan, reading null bins as NaN.
+func (scan *Scan) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		*scanFields
+		Bins []*float64 `json:"bins"`
+	}
+	decoded.scanFields = (*scanFields)(scan)
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	scan.Bins = nil
+	if decoded.Bins != nil {
+		scan.Bins = make([]unit.Decabel, len(decoded.Bins))
+	}
+
+	for i, bin := range decoded.Bins {
+		scan.Bins[i] = unit.Decabel(math.NaN())
+		if bin != nil {
+			scan.Bins[i] = unit.Decabel(*bin)
+		}
+	}
+
+	return nil
+}
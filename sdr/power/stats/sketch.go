@@ -0,0 +1,52 @@
+package stats
+
+import "math"
+
+// sketch approximates the distribution of a bin with a histogram of buckets
+// of a fixed width in dB. As dB are logarithmic, this keeps the relative
+// error of a percentile in linear power bounded, and the buckets only span
+// the range of power the bin has seen.
+type sketch struct {
+	// counts[i] counts the values in bucket offset+i.
+	offset int
+	counts []uint32
+	n      uint64
+}
+
+func (k *sketch) add(bucket int) {
+	switch {
+	case len(k.counts) == 0:
+		k.offset = bucket
+		k.counts = make([]uint32, 1, 8)
+
+	case bucket < k.offset:
+		grown := make([]uint32, k.offset-bucket+len(k.counts), k.offset-bucket+cap(k.counts))
+		copy(grown[k.offset-bucket:], k.counts)
+		k.offset, k.counts = bucket, grown
+
+	case bucket >= k.offset+len(k.counts):
+		k.counts = append(k.counts, make([]uint32, bucket-k.offset-len(k.counts)+1)...)
+	}
+
+	k.counts[bucket-k.offset]++
+	k.n++
+}
+
+// quantile returns the bucket holding the q-th quantile, q between 0 and 1.
+func (k *sketch) quantile(q float64) (int, bool) {
+	if k.n == 0 {
+		return 0, false
+	}
+
+	rank := uint64(math.Round(q * float64(k.n-1)))
+
+	var seen uint64
+	for i, count := range k.counts {
+		seen += uint64(count)
+		if seen > rank {
+			return k.offset + i, true
+		}
+	}
+
+	return k.offset + len(k.counts) - 1, true
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []int
+		q       float64
+		want    int
+		ok      bool
+	}{
+		{name: "empty", q: 0.5},
+		{name: "one value", buckets: []int{-600}, q: 0.5, want: -600, ok: true},
+		{name: "least", buckets: []int{3, 1, 2}, q: 0, want: 1, ok: true},
+		{name: "greatest", buckets: []int{3, 1, 2}, q: 1, want: 3, ok: true},
+		{name: "median", buckets: []int{5, 1, 4, 2, 3}, q: 0.5, want: 3, ok: true},
+		{name: "rounded rank", buckets: []int{1, 2, 3, 4}, q: 0.5, want: 3, ok: true},
+		{name: "repeated", buckets: []int{7, 7, 7, 1}, q: 0.25, want: 7, ok: true},
+		{name: "gap", buckets: []int{-10, 10}, q: 0.4, want: -10, ok: true},
+		{name: "grown downward", buckets: []int{10, 0, -10, -20}, q: 0.34, want: -10, ok: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var k sketch
+			for _, b := range test.buckets {
+				k.add(b)
+			}
+
+			got, ok := k.quantile(test.q)
+			if ok != test.ok || got != test.want {
+				t.Errorf("quantile(%v) = %d, %v, want %d, %v", test.q, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	inf := unit.Decabel(math.Inf(1))
+	nan := unit.Decabel(math.NaN())
+
+	tests := []struct {
+		name   string
+		values []unit.Decabel
+		p      float64
+		want   unit.Decabel
+	}{
+		{name: "no values", values: []unit.Decabel{nan, -inf}, p: 0.5, want: nan},
+		{name: "within the extremes", values: []unit.Decabel{-60.01}, p: 0.5, want: -60.01},
+		{name: "centre of the bucket", values: []unit.Decabel{-61, -60.04, -59}, p: 0.5, want: -60.05},
+		{name: "clamped p", values: []unit.Decabel{-61, -59}, p: 2, want: -59},
+		{name: "clamped to the limit", values: []unit.Decabel{-1000, 1000}, p: 0, want: -199.95},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := New()
+			for _, value := range test.values {
+				s.Add(&power.Scan{StartFrequency: 1e6, EndFrequency: 2e6, Bins: []unit.Decabel{value}})
+			}
+
+			got := s.Percentile(test.p).Bins[0]
+			if math.IsNaN(float64(test.want)) != math.IsNaN(float64(got)) || math.Abs(float64(got-test.want)) > 1e-9 {
+				t.Errorf("Percentile(%v) = %v, want %v", test.p, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+// Package stats summarises the power of each bin over many sweeps: the mean,
+// minimum and maximum, and percentiles approximated by sketches so that a
+// long observation run need not be held in memory.
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// DefaultTraces are the traces given when none are asked for.
+var DefaultTraces = []string{"min", "median", "p95", "max", "mean"}
+
+// MinResolution is the finest resolution of the percentile sketches.
+const MinResolution unit.Decabel = 0.01
+
+// limit clamps the values counted by the sketches, so that their buckets span
+// at most 2*limit/MinResolution whatever the values.
+const limit = 200
+
+type Option func(*Statistics)
+
+// Resolution sets the width in dB of the buckets of the percentile sketches,
+// 0.1 dB by default and at least MinResolution. Percentiles are accurate to
+// within half of it.
+func Resolution(resolution unit.Decabel) Option {
+	return func(s *Statistics) {
+		s.Resolution = resolution
+	}
+}
+
+// Statistics accumulates the sweeps of one frequency range and number of
+// bins.
+type Statistics struct {
+	Resolution unit.Decabel
+
+	// Start and End are the times of the first and last sweep added, and
+	// Sweeps their number.
+	Start  time.Time
+	End    time.Time
+	Sweeps int
+
+	layout *power.Scan
+
+	// each bin's count of values, linear sum, extremes and sketch.
+	counts   []int
+	sums     []float64
+	mins     []unit.Decabel
+	maxs     []unit.Decabel
+	sketches []sketch
+}
+
+func New(opts ...Option) *Statistics {
+	s := &Statistics{
+		Resolution: 0.1,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if !(s.Resolution > 0) || math.IsInf(float64(s.Resolution), 0) {
+		s.Resolution = 0.1
+	}
+	s.Resolution = max(MinResolution, s.Resolution)
+
+	return s
+}
+
+// Add accumulates a sweep. Sweeps whose frequency range or number of bins
+// differ from the first are not added, and it returns false.
+func (s *Statistics) Add(scan *power.Scan) bool {
+	if s.layout == nil {
+		layout := *scan
+		layout.Bins = make([]unit.Decabel, len(scan.Bins))
+		s.layout = &layout
+
+		n := len(scan.Bins)
+		s.counts = make([]int, n)
+		s.sums = make([]float64, n)
+		s.mins = make([]unit.Decabel, n)
+		s.maxs = make([]unit.Decabel, n)
+		s.sketches = make([]sketch, n)
+		s.Start = scan.DateTime
+	} else if !s.layout.SameLayout(scan) {
+		return false
+	}
+
+	s.End = scan.DateTime
+	s.Sweeps++
+
+	for i, bin := range scan.Bins {
+		value := float64(bin)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		if s.counts[i] == 0 || bin < s.mins[i] {
+			s.mins[i] = bin
+		}
+		if s.counts[i] == 0 || bin > s.maxs[i] {
+			s.maxs[i] = bin
+		}
+
+		s.counts[i]++
+		s.sums[i] += math.Pow(10, value/10)
+		s.sketches[i].add(int(math.Floor(max(-limit, min(limit, value)) / float64(s.Resolution))))
+	}
+
+	return true
+}
+
+// trace returns a scan of the layout with a bin per value of fn, NaN for
+// bins without values. It is nil before any sweep.
+func (s *Statistics) trace(fn func(bin int) unit.Decabel) *power.Scan {
+	if s.layout == nil {
+		return nil
+	}
+
+	trace := *s.layout
+	trace.DateTime = s.End
+	trace.Bins = make([]unit.Decabel, len(s.counts))
+
+	for i := range trace.Bins {
+		if s.counts[i] == 0 {
+			trace.Bins[i] = unit.Decabel(math.NaN())
+		} else {
+			trace.Bins[i] = fn(i)
+		}
+	}
+
+	return &trace
+}
+
+// Min returns the least power of each bin.
+func (s *Statistics) Min() *power.Scan {
+	return s.trace(func(i int) unit.Decabel { return s.mins[i] })
+}
+
+// Max returns the greatest power of each bin.
+func (s *Statistics) Max() *power.Scan {
+	return s.trace(func(i int) unit.Decabel { return s.maxs[i] })
+}
+
+// Mean returns the mean power of each bin, averaged in linear power.
+func (s *Statistics) Mean() *power.Scan {
+	return s.trace(func(i int) unit.Decabel {
+		return unit.Decabel(10 * math.Log10(s.sums[i]/float64(s.counts[i])))
+	})
+}
+
+// Percentile returns the p-th percentile of the power of each bin, p between
+// 0 and 1, to within half the resolution. It is the centre of the bucket it
+// falls in, kept within the least and greatest power.
+func (s *Statistics) Percentile(p float64) *power.Scan {
+	p = max(0, min(1, p))
+
+	return s.trace(func(i int) unit.Decabel {
+		bucket, _ := s.sketches[i].quantile(p)
+		value := (unit.Decabel(bucket) + 0.5) * s.Resolution
+		return max(s.mins[i], min(s.maxs[i], value))
+	})
+}
+
+// Trace returns the trace with the name: `min`, `max`, `mean`, `median` or a
+// percentile as `p95`, `p99.9` and so on. It is nil before any sweep.
+func (s *Statistics) Trace(name string) (*power.Scan, error) {
+	var fn func() *power.Scan
+
+	switch name {
+	case "min":
+		fn = s.Min
+	case "max":
+		fn = s.Max
+	case "mean":
+		fn = s.Mean
+	case "median":
+		fn = func() *power.Scan { return s.Percentile(0.5) }
+	default:
+		p, err := parsePercentile(name)
+		if err != nil {
+			return nil, err
+		}
+		fn = func() *power.Scan { return s.Percentile(p) }
+	}
+
+	return fn(), nil
+}
+
+// parsePercentile reads a percentile trace name, `p` and a percentage.
+func parsePercentile(name string) (float64, error) {
+	percent, ok := strings.CutPrefix(name, "p")
+	if ok {
+		value, err := strconv.ParseFloat(percent, 64)
+		if err == nil && value >= 0 && value <= 100 {
+			return value / 100, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown trace %q, expected min, max, mean, median or a percentile as p95", name)
+}
+
+// ValidTraces checks the trace names.
+func ValidTraces(names []string) error {
+	for _, name := range names {
+		switch name {
+		case "min", "max", "mean", "median":
+		default:
+			if _, err := parsePercentile(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Frequencies returns the lower edge of each bin.
+func (s *Statistics) Frequencies() []unit.Frequency {
+	if s.layout == nil {
+		return []unit.Frequency{}
+	}
+
+	width := (s.layout.EndFrequency - s.layout.StartFrequency) / unit.Frequency(len(s.counts))
+
+	frequencies := make([]unit.Frequency, len(s.counts))
+	for i := range frequencies {
+		frequencies[i] = s.layout.StartFrequency + width*unit.Frequency(i)
+	}
+
+	return frequencies
+}
+
+// WriteCSV writes a row per bin, its lower edge in Hz followed by the value of
+// each trace in dB. Bins without values are left empty.
+func (s *Statistics) WriteCSV(w io.Writer, names []string) error {
+	traces := make([]*power.Scan, len(names))
+	for i, name := range names {
+		trace, err := s.Trace(name)
+		if err != nil {
+			return err
+		}
+		traces[i] = trace
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"frequency_hz"}, names...))
+
+	for i, f := range s.Frequencies() {
+		row := []string{strconv.FormatFloat(float64(f), 'f', 0, 64)}
+		for _, trace := range traces {
+			value := ""
+			if bin := float64(trace.Bins[i]); !math.IsNaN(bin) {
+				value = strconv.FormatFloat(bin, 'f', 2, 64)
+			}
+			row = append(row, value)
+		}
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
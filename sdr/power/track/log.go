@@ -0,0 +1,148 @@
+package track
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Query selects emissions from a log. Zero values leave a side open.
+type Query struct {
+	// From and To select emissions that were active within [From, To].
+	From time.Time
+	To   time.Time
+
+	// Start and End select emissions that overlap [Start, End].
+	Start unit.Frequency
+	End   unit.Frequency
+
+	MinDuration time.Duration
+	MinPeak     *unit.Decabel
+	MinSNR      unit.Decabel
+
+	// Limit is the most emissions returned, the most recent first.
+	Limit int
+}
+
+func (q *Query) matches(e *Emission) bool {
+	switch {
+	case !q.From.IsZero() && e.End.Before(q.From):
+	case !q.To.IsZero() && e.Start.After(q.To):
+	case e.MaxFrequency < q.Start:
+	case q.End > 0 && e.MinFrequency > q.End:
+	case e.Duration() < q.MinDuration:
+	case q.MinPeak != nil && e.Peak < *q.MinPeak:
+	case e.SNR < q.MinSNR:
+	default:
+		return true
+	}
+
+	return false
+}
+
+// Log is an activity log of the emissions that ended, appended to a file of a
+// JSON object per line. Without a file it is only held in memory.
+type Log struct {
+	File string
+
+	mu        sync.RWMutex
+	file      *os.File
+	emissions []Emission
+}
+
+// OpenLog returns the log of the file, creating it when it does not exist.
+func OpenLog(name string) (*Log, error) {
+	l := &Log{File: name}
+
+	if name == "" {
+		return l, nil
+	}
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		var e Emission
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s:%d: %w", name, number, err)
+		}
+
+		l.emissions = append(l.emissions, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l.file = file
+	return l, nil
+}
+
+// Append adds the emissions to the log.
+func (l *Log) Append(emissions ...Emission) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.emissions = append(l.emissions, emissions...)
+
+	if l.file == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, e := range emissions {
+		line, err := json.Marshal(e)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Search returns the emissions matching the query, the most recent first.
+func (l *Log) Search(q Query) []Emission {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	emissions := []Emission{}
+	for i := len(l.emissions) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(emissions) >= q.Limit {
+			break
+		}
+
+		if e := &l.emissions[i]; q.matches(e) {
+			emissions = append(emissions, *e)
+		}
+	}
+
+	return emissions
+}
+
+// Close closes the file of the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
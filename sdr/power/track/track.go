@@ -0,0 +1,222 @@
+// Package track links the detections of consecutive sweeps into emissions,
+// transmissions with a start, an end and statistics of their power.
+package track
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power/detect"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Emission is a signal followed across sweeps.
+type Emission struct {
+	ID string `json:"id"`
+
+	// Start and End are the times of the first and last sweep it was
+	// detected in.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Frequency is the centre of the range it covered and Bandwidth its
+	// width, between MinFrequency and MaxFrequency.
+	Frequency    unit.Frequency `json:"frequency"`
+	Bandwidth    unit.Frequency `json:"bandwidth"`
+	MinFrequency unit.Frequency `json:"min_frequency"`
+	MaxFrequency unit.Frequency `json:"max_frequency"`
+
+	// Peak is the strongest power it reached, at PeakFrequency, and Mean the
+	// mean of its peak power over the sweeps.
+	Peak          unit.Decabel   `json:"peak"`
+	PeakFrequency unit.Frequency `json:"peak_frequency"`
+	Mean          unit.Decabel   `json:"mean"`
+	SNR           unit.Decabel   `json:"snr"`
+
+	// Sweeps is the number of sweeps it was detected in.
+	Sweeps int `json:"sweeps"`
+
+	// linear is the sum of the peak power of the sweeps.
+	linear float64
+}
+
+// Duration returns the time between the first and last sweep it was detected
+// in.
+func (e *Emission) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+func newEmission(d detect.Detection) *Emission {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	e := &Emission{
+		ID:           hex.EncodeToString(id),
+		Start:        d.Time,
+		MinFrequency: d.Frequency - d.Bandwidth/2,
+		MaxFrequency: d.Frequency + d.Bandwidth/2,
+		Peak:         d.Peak,
+	}
+	e.add(d)
+
+	return e
+}
+
+// add extends the emission with a detection.
+func (e *Emission) add(d detect.Detection) {
+	e.End = d.Time
+	e.MinFrequency = min(e.MinFrequency, d.Frequency-d.Bandwidth/2)
+	e.MaxFrequency = max(e.MaxFrequency, d.Frequency+d.Bandwidth/2)
+	e.Frequency = (e.MinFrequency + e.MaxFrequency) / 2
+	e.Bandwidth = e.MaxFrequency - e.MinFrequency
+
+	if d.Peak >= e.Peak {
+		e.Peak = d.Peak
+		e.PeakFrequency = d.PeakFrequency
+	}
+	e.SNR = max(e.SNR, d.SNR)
+
+	e.Sweeps++
+	e.linear += math.Pow(10, float64(d.Peak)/10)
+	e.Mean = unit.Decabel(10 * math.Log10(e.linear/float64(e.Sweeps)))
+}
+
+type Option func(*Tracker)
+
+// Gap sets the number of sweeps an emission may go undetected before it is
+// taken to have ended, 1 by default.
+func Gap(sweeps int) Option {
+	return func(t *Tracker) {
+		t.Gap = sweeps
+	}
+}
+
+// Tolerance sets how far apart the detections of consecutive sweeps may be
+// and still belong to the same emission. By default they must overlap.
+func Tolerance(tolerance unit.Frequency) Option {
+	return func(t *Tracker) {
+		t.Tolerance = tolerance
+	}
+}
+
+// MinSweeps sets the number of sweeps an emission must be detected in to be
+// reported, 1 by default.
+func MinSweeps(sweeps int) Option {
+	return func(t *Tracker) {
+		t.MinSweeps = sweeps
+	}
+}
+
+// active is an emission that may continue in the next sweep.
+type active struct {
+	*Emission
+	// last is the range of its most recent detection.
+	last   detect.Detection
+	missed int
+}
+
+// Tracker follows emissions through the detections of each sweep.
+type Tracker struct {
+	Gap       int
+	Tolerance unit.Frequency
+	MinSweeps int
+
+	mu     sync.Mutex
+	active []*active
+}
+
+func New(opts ...Option) *Tracker {
+	t := &Tracker{
+		Gap:       1,
+		MinSweeps: 1,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// matches reports whether a detection continues the most recent detection of
+// an emission.
+func (t *Tracker) matches(a *active, d detect.Detection) bool {
+	lo := a.last.Frequency - a.last.Bandwidth/2 - t.Tolerance
+	hi := a.last.Frequency + a.last.Bandwidth/2 + t.Tolerance
+
+	return d.Frequency+d.Bandwidth/2 >= lo && d.Frequency-d.Bandwidth/2 <= hi
+}
+
+// Update adds the detections of a sweep, returning the emissions that ended
+// before it.
+func (t *Tracker) Update(detections []detect.Detection) []Emission {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	matched := make([]bool, len(t.active))
+
+	for _, d := range detections {
+		// a detection continues the nearest emission it matches.
+		best := -1
+		for i, a := range t.active {
+			if matched[i] || !t.matches(a, d) {
+				continue
+			}
+
+			if best < 0 || math.Abs(float64(a.last.Frequency-d.Frequency)) < math.Abs(float64(t.active[best].last.Frequency-d.Frequency)) {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			t.active = append(t.active, &active{Emission: newEmission(d), last: d})
+			matched = append(matched, true)
+			continue
+		}
+
+		a := t.active[best]
+		a.add(d)
+		a.last = d
+		a.missed = 0
+		matched[best] = true
+	}
+
+	ended := []Emission{}
+	kept := t.active[:0]
+
+	for i, a := range t.active {
+		if !matched[i] {
+			a.missed++
+		}
+
+		if a.missed <= t.Gap {
+			kept = append(kept, a)
+		} else if a.Sweeps >= t.MinSweeps {
+			ended = append(ended, *a.Emission)
+		}
+	}
+
+	clear(t.active[len(kept):])
+	t.active = kept
+
+	return ended
+}
+
+// Active returns the emissions that have not yet ended and have been detected
+// in enough sweeps to be reported.
+func (t *Tracker) Active() []Emission {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	emissions := []Emission{}
+	for _, a := range t.active {
+		if a.Sweeps >= t.MinSweeps {
+			emissions = append(emissions, *a.Emission)
+		}
+	}
+
+	return emissions
+}
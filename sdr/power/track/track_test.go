@@ -0,0 +1,133 @@
+package track
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/olistrik/numa-sdr/api/sdr/power/detect"
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// ended is what is checked of an emission that ended.
+type ended struct {
+	MinFrequency unit.Frequency
+	MaxFrequency unit.Frequency
+	Peak         unit.Decabel
+	Sweeps       int
+}
+
+func TestTrackerUpdate(t *testing.T) {
+	epoch := time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)
+
+	// a detection in the given sweep, from lo to hi kHz.
+	at := func(sweep int, lo, hi float64, peak unit.Decabel) detect.Detection {
+		return detect.Detection{
+			Time:          epoch.Add(time.Duration(sweep) * time.Second),
+			Frequency:     unit.Frequency((lo + hi) / 2 * 1e3),
+			Bandwidth:     unit.Frequency((hi - lo) * 1e3),
+			Peak:          peak,
+			PeakFrequency: unit.Frequency((lo + hi) / 2 * 1e3),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		sweeps [][]detect.Detection
+		// want holds the emissions that end with each sweep.
+		want [][]ended
+		// active is the number of emissions left active.
+		active int
+	}{
+		{
+			name: "followed across sweeps",
+			sweeps: [][]detect.Detection{
+				{at(0, 100, 102, -20)},
+				{at(1, 101, 103, -10)},
+				{at(2, 99, 101, -30)},
+				{},
+				{},
+			},
+			want: [][]ended{nil, nil, nil, nil, {{99e3, 103e3, -10, 3}}},
+		},
+		{
+			name: "a gap is bridged",
+			sweeps: [][]detect.Detection{
+				{at(0, 100, 102, -20)},
+				{},
+				{at(2, 100, 102, -20)},
+				{},
+				{},
+			},
+			want: [][]ended{nil, nil, nil, nil, {{100e3, 102e3, -20, 2}}},
+		},
+		{
+			name: "too few sweeps",
+			opts: []Option{MinSweeps(2)},
+			sweeps: [][]detect.Detection{
+				{at(0, 100, 102, -20), at(0, 200, 202, -20)},
+				{at(1, 200, 202, -20)},
+				{},
+				{},
+			},
+			want: [][]ended{nil, nil, nil, {{200e3, 202e3, -20, 2}}},
+		},
+		{
+			name: "apart without a tolerance",
+			sweeps: [][]detect.Detection{
+				{at(0, 100, 102, -20)},
+				{at(1, 105, 107, -20)},
+				{},
+			},
+			want:   [][]ended{nil, nil, {{100e3, 102e3, -20, 1}}},
+			active: 1,
+		},
+		{
+			name: "within the tolerance",
+			opts: []Option{Tolerance(5e3)},
+			sweeps: [][]detect.Detection{
+				{at(0, 100, 102, -20)},
+				{at(1, 105, 107, -20)},
+				{},
+			},
+			want:   [][]ended{nil, nil, nil},
+			active: 1,
+		},
+		{
+			name: "the nearest is continued",
+			opts: []Option{Tolerance(10e3), Gap(0)},
+			sweeps: [][]detect.Detection{
+				{at(0, 100, 102, -20), at(0, 110, 112, -30)},
+				{at(1, 108, 110, -25)},
+				{},
+			},
+			want: [][]ended{
+				nil,
+				{{100e3, 102e3, -20, 1}},
+				{{108e3, 112e3, -25, 2}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := New(test.opts...)
+
+			for i, detections := range test.sweeps {
+				var got []ended
+				for _, e := range tracker.Update(detections) {
+					got = append(got, ended{e.MinFrequency, e.MaxFrequency, e.Peak, e.Sweeps})
+				}
+
+				if !slices.Equal(got, test.want[i]) {
+					t.Errorf("sweep %d ended %+v, want %+v", i, got, test.want[i])
+				}
+			}
+
+			if got := len(tracker.Active()); got != test.active {
+				t.Errorf("%d emissions are active, want %d", got, test.active)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package power
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/olistrik/numa-sdr/api/unit"
+)
+
+// Writer writes scans as rtl_power CSV. A scan appended from several hops is
+// split back into a line per hop when Hops is set, and otherwise written as a
+// single line spanning all of them.
+type Writer struct {
+	// Hops is the number of hops in each sweep. Scans whose bins cannot be
+	// split evenly between them are written on a single line.
+	Hops int
+
+	w   *bufio.Writer
+	buf []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write formats the scan the way rtl_power does, a line per hop.
+func (w *Writer) Write(scan *Scan) error {
+	hops := w.Hops
+	if hops <= 1 || len(scan.Bins)%hops != 0 {
+		return w.writeLine(scan)
+	}
+
+	width := (scan.EndFrequency - scan.StartFrequency) / unit.Frequency(hops)
+	bins := len(scan.Bins) / hops
+
+	for i := range hops {
+		hop := *scan
+		hop.StartFrequency = unit.Frequency(math.Round(float64(scan.StartFrequency + width*unit.Frequency(i))))
+		hop.EndFrequency = unit.Frequency(math.Round(float64(scan.StartFrequency + width*unit.Frequency(i+1))))
+		hop.Bins = scan.Bins[i*bins : (i+1)*bins]
+
+		if err := w.writeLine(&hop); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeLine writes the scan on one line: the date and time, integer start and
+// end frequencies, the bin step and sample count, and the bins with two
+// decimals.
+func (w *Writer) writeLine(scan *Scan) error {
+	buf := w.buf[:0]
+
+	buf = scan.DateTime.AppendFormat(buf, "2006-01-02, 15:04:05")
+	buf = append(buf, ", "...)
+	buf = strconv.AppendInt(buf, int64(scan.StartFrequency), 10)
+	buf = append(buf, ", "...)
+	buf = strconv.AppendInt(buf, int64(scan.EndFrequency), 10)
+	buf = append(buf, ", "...)
+	buf = strconv.AppendFloat(buf, float64(scan.SampleRate), 'f', 2, 64)
+	buf = append(buf, ", "...)
+	buf = strconv.AppendUint(buf, uint64(scan.SampleCount), 10)
+
+	for _, bin := range scan.Bins {
+		buf = append(buf, ", "...)
+		buf = strconv.AppendFloat(buf, float64(bin), 'f', 2, 64)
+	}
+
+	buf = append(buf, '\n')
+	w.buf = buf
+
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// Flush writes any buffered lines to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -1,6 +1,7 @@
 package unit
 
 import (
+	"encoding/json"
 	"strconv"
 )
 
@@ -40,3 +41,13 @@ func (n *Frequency) UnmarshalText(b []byte) error {
 	*n = Frequency(val)
 	return nil
 }
+
+// UnmarshalJSON accepts a frequency as either a JSON number or a string.
+func (n *Frequency) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		return n.UnmarshalText([]byte(s))
+	}
+
+	return n.UnmarshalText(b)
+}